@@ -36,6 +36,8 @@ var checkCmd = &cobra.Command{
 by the UI. This may not always reflect the actual connection
 state, as there is some delay before the modem detects a drop.
 
+The IPv6 WAN address and delegated prefix are also reported, if IPv6 is enabled.
+
 Exits with a code of 2 if the modem reports as disconnected.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := conn.Login(ctx); err != nil {
@@ -43,14 +45,21 @@ Exits with a code of 2 if the modem reports as disconnected.`,
 			return
 		}
 
-		connected, err := conn.ModemIsConnected(ctx)
+		status, err := conn.WANStatus(ctx)
 		if err != nil {
 			level.Error(logger).Log("msg", "failed to check state", "err", err)
 			return
 		}
 
-		if connected {
-			level.Info(logger).Log("msg", "Modem believes connection is active")
+		// Lines without IPv6 have no IPv6 field on the status page, which is not an outage
+		if status.IPv6Connected() {
+			level.Info(logger).Log("msg", "Modem believes IPv6 connection is active", "wan_ipv6", status.IPv6, "delegated_prefix", status.IPv6Prefix)
+		} else if status.IPv6Enabled {
+			level.Info(logger).Log("msg", "Modem believes IPv6 connection is down")
+		}
+
+		if status.Connected() {
+			level.Info(logger).Log("msg", "Modem believes connection is active", "wan_ip", status.IP)
 		} else {
 			level.Info(logger).Log("msg", "Modem believes connection is down")
 			os.Exit(2)
@@ -0,0 +1,75 @@
+/*
+Copyright © 2020 George Field <george@cucurbit.dev>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/ks07/t11c-reset/internal"
+)
+
+var pauseFor time.Duration
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pauses remediation by a running watch",
+	Long: `Pauses remediation by a running watch command for a while, e.g. while changing the
+router's settings by hand. The connection is still probed and logged, but the modem is
+not reset and the router is not logged in to until the pause ends.
+
+The watch command must use the same --pause-file, which by default is kept in the watch
+state directory and so can only be written by the user the watch command runs as.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		until := time.Now().Add(pauseFor)
+		if err := internal.WritePause(viper.GetString("pause-file"), until); err != nil {
+			level.Error(logger).Log("msg", "failed to pause", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "remediation paused", "until", until.UTC().Format(time.RFC3339))
+	},
+}
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resumes remediation by a running watch after a pause",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := internal.WritePause(viper.GetString("pause-file"), time.Time{}); err != nil {
+			level.Error(logger).Log("msg", "failed to resume", "err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "remediation resumed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+
+	pauseCmd.Flags().DurationVar(&pauseFor, "for", time.Hour, "How long to pause remediation for")
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2020 George Field <george@cucurbit.dev>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/spf13/cobra"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+var (
+	probeRemote string
+	probeIPv6   bool
+	mtuSizes    []int
+
+	routerPingCount int
+)
+
+// probeCmd represents the probe command
+var probeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Runs a one-off diagnostic probe of the connection",
+	Long: `Runs a one-off diagnostic probe of the connection. Probes are run from this
+machine, except for "router-ping", which is run by the router itself.`,
+}
+
+// probeMTUCmd represents the probe mtu command
+var probeMTUCmd = &cobra.Command{
+	Use:   "mtu",
+	Short: "Finds the largest packet size that reaches a remote host without fragmentation",
+	Long: `Pings a remote host with the "don't fragment" flag set, at each of a ladder of
+packet sizes, and reports the largest size that was answered. Sizes are of the whole IP
+packet, i.e. the MTU, so a healthy PPPoE connection should reach 1492.
+
+If small packets are answered but large ones are not, the connection likely has an MTU
+black hole, where large TCP transfers will hang.
+
+Exits with a code of 2 if no packet size was answered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := net.ParseTargets([]string{probeRemote}, probeIPv6)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid remote host", "err", err)
+			os.Exit(1)
+		}
+
+		checker := net.NewPingChecker(net.PingConfig{RawSocket: privileged, Binding: binding})
+		result, err := checker.ProbeMTU(ctx, targets[0], mtuSizes)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to probe MTU", "err", err)
+			os.Exit(1)
+		}
+
+		for _, step := range result.Steps {
+			level.Info(logger).Log("remote_host", probeRemote, "size", step.Size, "ok", step.OK, "latency", step.Rtt, "send_err", step.SendErr)
+		}
+
+		if result.Largest == 0 {
+			level.Info(logger).Log("msg", "no packet size was answered", "remote_host", probeRemote)
+			os.Exit(2)
+		}
+		level.Info(logger).Log("msg", "largest working packet size", "remote_host", probeRemote, "size", result.Largest)
+	},
+}
+
+// probeRouterPingCmd represents the probe router-ping command
+var probeRouterPingCmd = &cobra.Command{
+	Use:   "router-ping",
+	Short: "Pings a remote host from the router itself",
+	Long: `Logs in to the router and pings a remote host using its diagnostics page. As the
+ping is sent by the router, this shows whether the WAN connection is working regardless
+of the network between this machine and the router.
+
+This is experimental: the diagnostics form and its output are assumed to follow the
+usual busybox ping format, and have not been checked against every firmware version.
+
+Exits with a code of 2 if no ping was answered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := conn.Login(ctx); err != nil {
+			level.Error(logger).Log("msg", "failed to login", "err", err)
+			os.Exit(1)
+		}
+
+		result, err := conn.DiagnosticPing(ctx, probeRemote, routerPingCount)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to ping from router", "err", err)
+			os.Exit(1)
+		}
+
+		level.Info(logger).Log("remote_host", probeRemote, "packets_sent", result.Transmitted, "packets_received", result.Received, "latency", result.AvgRtt)
+		if result.Failed() {
+			level.Info(logger).Log("msg", "no ping was answered", "remote_host", probeRemote)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(probeCmd)
+	probeCmd.AddCommand(probeMTUCmd)
+	probeCmd.AddCommand(probeRouterPingCmd)
+
+	probeCmd.PersistentFlags().BoolVarP(&privileged, "raw-ping", "p", false, "Attempt to use raw sockets to send ping (ignored on Windows)")
+	probeCmd.PersistentFlags().StringVarP(&probeRemote, "remote", "r", "1.1.1.1", "The remote address to probe")
+	probeCmd.PersistentFlags().BoolVar(&probeIPv6, "ipv6", false, "Probe the remote host over IPv6")
+
+	probeMTUCmd.Flags().IntSliceVar(&mtuSizes, "sizes", net.DefaultMTUSizes, "The IP packet sizes to probe")
+
+	probeRouterPingCmd.Flags().IntVar(&routerPingCount, "count", 3, "The number of pings for the router to send")
+}
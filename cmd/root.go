@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -33,6 +34,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/ks07/t11c-reset/pkg/net"
 	"github.com/ks07/t11c-reset/pkg/t11c"
 )
 
@@ -43,11 +45,14 @@ var (
 	username string
 	password string
 	hostname string
-
-	cancel context.CancelFunc
-	ctx    context.Context
-	conn   *t11c.Connection
-	logger log.Logger
+	bindTo   string
+	pauseTo  string
+
+	binding net.Binding
+	cancel  context.CancelFunc
+	ctx     context.Context
+	conn    *t11c.Connection
+	logger  log.Logger
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -84,7 +89,16 @@ and hostname of the router.`,
 			}
 		}()
 
+		binding = net.ParseBinding(viper.GetString("bind"))
+		if err := binding.Validate(); err != nil {
+			level.Error(logger).Log("msg", "invalid binding", "err", err)
+			os.Exit(1)
+		}
+
 		conn = t11c.NewConnection(logger, viper.GetBool("no-action"), viper.GetString("username"), viper.GetString("password"), viper.GetString("hostname"))
+		if !binding.IsZero() {
+			conn.Dialer = binding.Dialer()
+		}
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		cancel()
@@ -111,6 +125,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&username, "username", "admin", "The username to login with")
 	rootCmd.PersistentFlags().StringVar(&password, "password", "", "The password to login with")
 	rootCmd.PersistentFlags().StringVar(&hostname, "hostname", "192.168.1.1", "The hostname or IP of the router")
+	rootCmd.PersistentFlags().StringVar(&bindTo, "bind", "", "The source address or interface name to send router requests and probes from")
+	rootCmd.PersistentFlags().StringVar(&pauseTo, "pause-file", defaultPauseFile(), "The file used to pause remediation by a running watch")
 
 	// Flags may be passed via environment variables with this prefix
 	viper.SetEnvPrefix("T11C_")
@@ -143,3 +159,18 @@ func initConfig() {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// defaultStateDir returns the state directory given by systemd's StateDirectory=, or the system state directory
+// otherwise
+func defaultStateDir() string {
+	if dirs := os.Getenv("STATE_DIRECTORY"); dirs != "" {
+		return filepath.SplitList(dirs)[0]
+	}
+	return "/var/lib/t11c-reset"
+}
+
+// defaultPauseFile returns the pause file in the state directory, which unlike the temporary directory cannot be
+// written to by other users
+func defaultPauseFile() string {
+	return filepath.Join(defaultStateDir(), "pause")
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2020 George Field <george@cucurbit.dev>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/spf13/cobra"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+const defaultSpeedtestURL = "https://speed.cloudflare.com/__down?bytes=100000000"
+
+var (
+	speedtestURL     string
+	speedtestMaxMB   int64
+	speedtestMaxTime time.Duration
+)
+
+// speedtestCmd represents the speedtest command
+var speedtestCmd = &cobra.Command{
+	Use:   "speedtest",
+	Short: "Measures download throughput from a remote URL",
+	Long: `Downloads from a remote URL until either the size or time limit is reached, and
+reports the throughput and the time to the first byte of the response.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := net.MeasureThroughput(ctx, speedtestConfig())
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to measure throughput", "err", err)
+			os.Exit(1)
+		}
+
+		level.Info(logger).Log("url", speedtestURL, "bytes", result.Bytes, "ttfb", result.TTFB, "duration", result.Duration, "mbps", fmt.Sprintf("%.2f", result.Mbps()))
+	},
+}
+
+func speedtestConfig() net.ThroughputConfig {
+	return net.ThroughputConfig{
+		URL:         speedtestURL,
+		MaxBytes:    speedtestMaxMB * 1000 * 1000,
+		MaxDuration: speedtestMaxTime,
+		Binding:     binding,
+	}
+}
+
+// addSpeedtestFlags adds the flags describing the download to a command
+func addSpeedtestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&speedtestURL, "speedtest-url", defaultSpeedtestURL, "The URL to download from to measure throughput")
+	cmd.Flags().Int64Var(&speedtestMaxMB, "speedtest-size", 25, "The maximum size of the download, in megabytes")
+	cmd.Flags().DurationVar(&speedtestMaxTime, "speedtest-time", 15*time.Second, "The maximum duration of the download")
+}
+
+func init() {
+	rootCmd.AddCommand(speedtestCmd)
+
+	addSpeedtestFlags(speedtestCmd)
+}
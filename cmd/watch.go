@@ -22,15 +22,113 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/ks07/t11c-reset/internal"
+	"github.com/ks07/t11c-reset/pkg/net"
 )
 
 var (
 	interval    uint
 	privileged  bool
 	remoteHosts []string
+	quorum      uint
+	dnsRefresh  time.Duration
+
+	downAfter       int
+	upAfter         int
+	suspectInterval time.Duration
+	stateDir        string
+
+	hooks       []string
+	hookTimeout time.Duration
+
+	webhooks        []string
+	webhookTemplate string
+	webhookEvents   []string
+	webhookMaxAge   time.Duration
+
+	smtpServer   string
+	smtpSecurity string
+	smtpUsername string
+	smtpPassword string
+	smtpFrom     string
+	smtpTo       []string
+	smtpEvents   []string
+	smtpMaxAge   time.Duration
+
+	mqttBroker          string
+	mqttClientID        string
+	mqttUsername        string
+	mqttPassword        string
+	mqttTopic           string
+	mqttDiscoveryPrefix string
+
+	remoteHosts6    []string
+	quorum6         uint
+	ipv6Reset       bool
+	ipv6ResetAfter  int
+	ipv6ResetPeriod time.Duration
+	diagnose        bool
+	linkInterface   string
+	routerPing      string
+
+	routerTimeout  time.Duration
+	routerFailures int
+	routerAction   string
+
+	retryAttempts   int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+
+	budgetPerHour int
+	budgetPerDay  int
+	budgetGap     time.Duration
+
+	maintenance []string
+
+	reconnectSchedule   string
+	reconnectMinUptime  time.Duration
+	reconnectIdleKbps   float64
+	reconnectIdleSample time.Duration
+	reconnectWindow     time.Duration
+
+	escalation        []string
+	powerCycleCommand string
+
+	demoteAfter    int
+	demoteFor      time.Duration
+	statusInterval time.Duration
+
+	mtuExpected int
+	mtuInterval time.Duration
+	mtuReset    bool
+
+	speedtestInterval time.Duration
+	speedtestMinMbps  float64
+	speedtestRuns     int
+	speedtestReset    bool
+
+	degradeWindow      int
+	degradeLoss        float64
+	degradeRtt         time.Duration
+	degradeJitter      time.Duration
+	degradeChecks      int
+	degradeReset       bool
+	degradeResetPeriod time.Duration
+
+	recoverySuccesses int
+	recoveryPerTarget bool
+	recoveryTargets   int
+	recoveryStable    time.Duration
+	recoveryMaxWait   time.Duration
 )
 
 // watchCmd represents the watch command
@@ -40,12 +138,339 @@ var watchCmd = &cobra.Command{
 	Long: `Regularly pings an external server to check for connectivity issues. If packets
 are lost, then connect to the router and reset the modem.
 
-If multiple remote hosts are specified, the additional hosts will be used to confirm a loss
-of connectivity. In the event that the ping test to the first host fails, the second host
-will be tested (and so on), and the connection will only be treated as down if all hosts fail.
-This is useful to defend against outages on the remote end from triggering a reset.`,
+If multiple remote hosts are specified, all hosts are pinged concurrently and the
+connection is only treated as down once the quorum of hosts has failed. By default every
+host must fail, which defends against outages on the remote end from triggering a reset.
+
+Each host may be given a weight with the form "host=weight" (e.g. "1.1.1.1=2"). The quorum
+is the total weight of failed hosts at which the connection is treated as down, so with
+unweighted hosts a quorum of 2 means "down if at least 2 hosts fail".
+
+A host given as "router-ping:host" is pinged by the router itself, using its diagnostics
+page (see "probe router-ping"), rather than from this machine. Such hosts count towards
+the quorum like any other, but are not used to wait for the connection to recover after a
+reset, so at least one host must not be a router-ping host. They are also skipped during
+maintenance, as the router is not logged in to then. Router pings are experimental, as the diagnostics page has not been checked against
+every firmware version.
+
+The connection is only declared down after --down-after consecutive failed checks, and
+declared up again after --up-after consecutive successful checks. While the state is
+changing, checks are made every --suspect-interval instead of every --interval.
+
+A remote host that keeps failing while the others respond is demoted for a while, so
+that it is neither pinged nor counted towards the quorum. The health of each host is
+included in the periodic status log line.
+
+A connection that is up can also be treated as degraded, based on the packet loss, median
+latency or jitter measured over a rolling window of recent checks. A degraded connection
+is only logged, unless --degrade-reset is given.
+
+IPv6 connectivity can be monitored by giving IPv6 remote hosts with --remote6, which have
+a separate quorum. By default a failure of IPv6 alone is only logged, unless --ipv6-reset
+is given. The modem is then reset once IPv6 has been down for --ipv6-reset-after
+consecutive checks, at most once every --ipv6-reset-interval. Remediation continues
+until IPv6 is seen up again, so --retry-attempts applies to repeated IPv6 resets.
+
+When the connection is down, the modem is reset. With --diagnose, the fault is first
+localised by checking the local network interface, the router's web interface, and the
+PPP gateway reported by the router, and the modem is only reset if the fault lies beyond
+the router or cannot be localised. With --router-ping, the router is also asked to ping a remote host from its
+diagnostics page, and the modem is not reset if the router itself can reach it. This is
+experimental, like router-ping remote hosts.
+
+Each attempt to restore the connection takes the next step of the escalation ladder
+given by --escalation, repeating the last step once the ladder is exhausted. Each step
+is given as "action[:max wait[:successes]]", where the optional fields override
+--recovery-max-wait and --recovery-successes for that step. The actions are:
+
+  redial       disconnect and reconnect the PPP session
+  retrain      retrain the DSL line (experimental)
+  reboot       reboot the router (experimental)
+  power-cycle  run the command given by --power-cycle-command
+  alert        log an event and stop remediating until the connection is next up
+
+For example: --escalation redial,redial,retrain:2m,reboot:5m:5,power-cycle:5m:5,alert
+
+The retrain and reboot actions are experimental, as the router's maintenance forms they
+submit have not been checked against every firmware version. A step fails if the router
+rejects the form.
+
+A failed reset is retried after an exponentially increasing delay, starting from
+--retry-backoff and capped at --retry-max-backoff, which must be positive. By default it
+keeps retrying at --retry-max-backoff intervals; with --retry-attempts, remediation gives up
+after that many consecutive failures until the connection is next seen up or watch is
+restarted.
+
+Resets are limited by a budget, so that a long ISP outage does not cause a stream of
+redials: at most --max-resets-hour in any hour and --max-resets-day in any day, at least
+--min-reset-gap apart. While the budget is exhausted, an event is logged and the
+connection is only observed.
+
+Remediation can be suppressed during maintenance windows given by --maintenance, in the
+form "[days] HH:MM-HH:MM [timezone]" (e.g. "Mon-Fri 09:00-17:30 Europe/London"), or for
+a while by the "pause" command. The connection is still probed and logged, but the modem
+is not reset and the router is not logged in to.
+
+The modem can also be reconnected on a schedule with --reconnect-schedule, given as a
+cron expression (e.g. "CRON_TZ=Europe/London 0 4 * * *" for 4am every night). A scheduled
+reconnect only runs once the connection has been up for --reconnect-min-uptime and, if
+--reconnect-idle-kbps is given, while WAN traffic is below that rate. WAN traffic is
+measured from the router's counters between checks at least --reconnect-idle-sample apart;
+reading the counters is experimental. A reconnect that cannot run within
+--reconnect-window of being due is skipped.
+
+The router's web interface is also probed on each check. If it fails to respond within
+--router-timeout for --router-failures consecutive probes, the router is treated as
+unresponsive: remediation is paused rather than repeatedly trying to log in, and the
+command given by --router-action (e.g. a script that power cycles the router) is run.
+
+The declared connection state, the current outage and recent resets are saved in
+--state-dir, so that they survive a restart and budgets and cooldowns are still applied.
+This defaults to $STATE_DIRECTORY when run by systemd with StateDirectory=, and to
+/var/lib/t11c-reset otherwise. Use --state-dir "" to disable this.
+
+External commands can be run on events with --hook, given as "event=command [args...]"
+where event is an event name from the log (e.g. connection_down, reset_started or
+connection_up) or "*" for every event. Commands run in the background, and are given
+the event as JSON on stdin and as T11C_EVENT, T11C_MESSAGE, T11C_TIME and T11C_<DETAIL>
+environment variables. Their output is logged.
+
+Events can be sent to webhooks with --webhook. By default the event is sent as JSON, but
+a Go template file can be given with --webhook-template to suit the endpoint, e.g. for
+Slack: {"text": {{ printf "%s: %s" .Kind .Message | json }}}. The template is executed
+with the event, which has Kind, Time, Message and Details fields; the connection_up
+event has an "outage" detail with the length of the outage. Events that cannot be sent
+while the connection is down are queued, and retried until they are --webhook-max-age
+old.
+
+Events can also be emailed with --smtp-server (host:port) and --smtp-to. The connection
+uses STARTTLS unless --smtp-security is "tls" (implicit TLS, usually port 465) or "none".
+With "none", --smtp-username can only be used with a mail server on this machine.
+The password for --smtp-username may be given in the T11C_SMTP_PASSWORD environment
+variable rather than with --smtp-password. Events that cannot be sent while the
+connection is down are queued, and sent as a single summary once it is back up.
+
+The watch state can be published to an MQTT broker with --mqtt-broker, e.g.
+tcp://localhost:1883. Retained messages under --mqtt-topic give the connection state
+(state), the local link (link), the WAN IP (wan_ip), the latency in ms and packet loss in %
+of the last check (latency, loss), and the total and last 24 hours' resets (resets,
+resets_24h). Each event is published as JSON to the event topic. The availability topic is
+"online" while watch is running, and the broker sets it to "offline" if the connection is
+lost. Publishing "reconnect" to the command topic reconnects the modem, unless it is in
+maintenance or the reset budget is exhausted. Home Assistant discovery payloads are
+published under --mqtt-discovery-prefix. The password may be given in the
+T11C_MQTT_PASSWORD environment variable rather than with --mqtt-password.
+
+Monitoring is paused while the local network interface used to reach the router (or the
+interface given by --link-interface or --bind) has no link. While its state cannot be read,
+the connection is still probed and logged, but not reset.
+The interface used to reach the router is remembered, so that its link is still watched
+when unplugging it removes its address and route.
+
+The connection can also be checked for an MTU black hole with --mtu-expected, which
+periodically pings the first remote host with the "don't fragment" flag set at each of
+the sizes given by --mtu-sizes (see "probe mtu"). If the smallest size is answered but the
+expected size is not, an event is logged, and the modem is reset if --mtu-reset is given.
+The MTU is checked again straight after other resets, but only after --mtu-interval once a
+black hole has been found. If the smallest size is not answered either, the check is
+inconclusive and is ignored.
+
+Throughput can be measured periodically with --speedtest-interval (see "speedtest"). If
+the throughput is below --speedtest-min for --speedtest-runs consecutive measurements, an
+event is logged, and the modem is reset if --speedtest-reset is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		internal.WatchReset(ctx, logger, conn, interval, privileged, remoteHosts)
+		targets, err := net.ParseTargets(remoteHosts, false)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid remote host", "err", err)
+			os.Exit(1)
+		}
+		// Router-ping targets are not used to wait for recovery, so at least one host must be pinged from here
+		pingedLocally := false
+		for _, t := range targets {
+			pingedLocally = pingedLocally || !t.Router
+		}
+		if len(targets) > 0 && !pingedLocally {
+			level.Error(logger).Log("msg", "at least one remote host must be pinged from this machine rather than with router-ping")
+			os.Exit(1)
+		}
+		targets6, err := net.ParseTargets(remoteHosts6, true)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid IPv6 remote host", "err", err)
+			os.Exit(1)
+		}
+		if err := binding.Validate(append(targets, targets6...)...); err != nil {
+			level.Error(logger).Log("msg", "invalid binding", "err", err)
+			os.Exit(1)
+		}
+
+		if retryMaxBackoff <= 0 {
+			level.Error(logger).Log("msg", "--retry-max-backoff must be positive")
+			os.Exit(1)
+		}
+
+		ladder, err := internal.ParseEscalation(escalation)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid escalation ladder", "err", err)
+			os.Exit(1)
+		}
+		recovery := net.RecoveryPolicy{
+			Successes:  recoverySuccesses,
+			PerTarget:  recoveryPerTarget,
+			MinTargets: recoveryTargets,
+			StableFor:  recoveryStable,
+			MaxWait:    recoveryMaxWait,
+		}
+		if err := recovery.Validate(); err != nil {
+			level.Error(logger).Log("msg", "invalid recovery policy, --recovery-stable must be shorter than --recovery-max-wait", "err", err)
+			os.Exit(1)
+		}
+		for _, step := range ladder {
+			if step.Action == internal.ActionPowerCycle && powerCycleCommand == "" {
+				level.Error(logger).Log("msg", "the power-cycle escalation step requires --power-cycle-command")
+				os.Exit(1)
+			}
+			if err := step.RecoveryPolicy(recovery).Validate(); err != nil {
+				level.Error(logger).Log("msg", "invalid escalation step, its maximum wait must be longer than --recovery-stable", "action", step.Action, "err", err)
+				os.Exit(1)
+			}
+		}
+
+		windows, err := internal.ParseMaintenanceWindows(maintenance)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid maintenance window", "err", err)
+			os.Exit(1)
+		}
+
+		var schedule internal.Schedule
+		if reconnectSchedule != "" {
+			if schedule, err = internal.ParseSchedule(reconnectSchedule); err != nil {
+				level.Error(logger).Log("msg", "invalid reconnect schedule", "err", err)
+				os.Exit(1)
+			}
+		}
+
+		hookList, err := internal.ParseHooks(hooks)
+		if err != nil {
+			level.Error(logger).Log("msg", "invalid hook", "err", err)
+			os.Exit(1)
+		}
+		var notifiers []internal.Notifier
+		if len(hookList) > 0 {
+			notifiers = append(notifiers, internal.NewHookRunner(logger, hookList, hookTimeout))
+		}
+
+		if len(webhooks) > 0 {
+			cfg, err := webhookConfig()
+			if err != nil {
+				level.Error(logger).Log("msg", "invalid webhook configuration", "err", err)
+				os.Exit(1)
+			}
+			for _, u := range webhooks {
+				cfg.URL = u
+				notifiers = append(notifiers, internal.NewWebhook(logger, cfg))
+			}
+		}
+
+		if smtpServer != "" {
+			sn, err := smtpNotifier()
+			if err != nil {
+				level.Error(logger).Log("msg", "invalid SMTP configuration", "err", err)
+				os.Exit(1)
+			}
+			notifiers = append(notifiers, sn)
+		}
+
+		var reconnects <-chan string
+		if mqttBroker != "" {
+			m := mqttReporter()
+			notifiers = append(notifiers, m)
+			reconnects = m.Reconnects()
+		}
+
+		internal.WatchReset(ctx, logger, conn, internal.WatchConfig{
+			Interval: interval,
+			Hysteresis: internal.Hysteresis{
+				DownAfter:       downAfter,
+				UpAfter:         upAfter,
+				SuspectInterval: suspectInterval,
+			},
+			Ping: net.PingConfig{
+				Targets:        append(targets, targets6...),
+				Quorum:         net.Quorum{FailWeight: quorum},
+				Quorum6:        net.Quorum{FailWeight: quorum6},
+				RawSocket:      privileged,
+				Binding:        binding,
+				ResolveRefresh: dnsRefresh,
+				Health: net.HealthPolicy{
+					DemoteAfter: demoteAfter,
+					DemoteFor:   demoteFor,
+				},
+				Recovery: recovery,
+			},
+			Degradation: net.DegradationRules{
+				Window:       degradeWindow,
+				MaxLoss:      degradeLoss,
+				MaxMedianRtt: degradeRtt,
+				MaxJitter:    degradeJitter,
+				Consecutive:  degradeChecks,
+			},
+			Degraded: internal.DegradedPolicy{
+				Reset:       degradeReset,
+				MinInterval: degradeResetPeriod,
+			},
+			IPv6: internal.IPv6Policy{
+				Reset:       ipv6Reset,
+				After:       ipv6ResetAfter,
+				MinInterval: ipv6ResetPeriod,
+			},
+			Diagnose:      diagnose,
+			RouterPing:    routerPing,
+			LinkInterface: linkInterface,
+			Router: internal.RouterHealthCheck{
+				Timeout:  routerTimeout,
+				Failures: routerFailures,
+				Action:   strings.Fields(routerAction),
+			},
+			Retry: internal.RetryPolicy{
+				MaxAttempts: retryAttempts,
+				Backoff:     retryBackoff,
+				MaxBackoff:  retryMaxBackoff,
+			},
+			Escalation: ladder,
+			Budget: internal.ResetBudget{
+				PerHour: budgetPerHour,
+				PerDay:  budgetPerDay,
+				MinGap:  budgetGap,
+			},
+			Maintenance: windows,
+			PauseFile:   viper.GetString("pause-file"),
+			StateDir:    stateDir,
+			Notifiers:   notifiers,
+			Reconnect:   reconnects,
+			Scheduled: internal.ScheduledReconnect{
+				Schedule:   schedule,
+				MinUptime:  reconnectMinUptime,
+				IdleKbps:   reconnectIdleKbps,
+				IdleSample: reconnectIdleSample,
+				Window:     reconnectWindow,
+			},
+			PowerCycle: strings.Fields(powerCycleCommand),
+
+			StatusInterval: statusInterval,
+			MTU: internal.MTUCheck{
+				Expected: mtuExpected,
+				Sizes:    mtuSizes,
+				Interval: mtuInterval,
+				Reset:    mtuReset,
+			},
+			Throughput: internal.ThroughputCheck{
+				Probe:    speedtestConfig(),
+				Interval: speedtestInterval,
+				MinMbps:  speedtestMinMbps,
+				Runs:     speedtestRuns,
+				Reset:    speedtestReset,
+			},
+		})
 	},
 }
 
@@ -54,5 +479,167 @@ func init() {
 
 	watchCmd.Flags().BoolVarP(&privileged, "raw-ping", "p", false, "Attempt to use raw sockets to send ping (ignored on Windows)")
 	watchCmd.Flags().UintVarP(&interval, "interval", "i", 15, "The interval, in seconds, between ping tests")
-	watchCmd.Flags().StringSliceVarP(&remoteHosts, "remote", "r", []string{"1.1.1.1"}, "The remote address to ping to test connectivity. May be specified multiple times to defend against remote outages.")
+	watchCmd.Flags().StringSliceVarP(&remoteHosts, "remote", "r", []string{"1.1.1.1"}, "The remote address to ping to test connectivity, optionally weighted as host=weight. May be specified multiple times to defend against remote outages.")
+	watchCmd.Flags().UintVarP(&quorum, "quorum", "q", 0, "The total weight of failed remote hosts required to treat the connection as down (0 requires all hosts to fail)")
+	watchCmd.Flags().IntVar(&downAfter, "down-after", 2, "The number of consecutive failed checks before the connection is declared down")
+	watchCmd.Flags().IntVar(&upAfter, "up-after", 2, "The number of consecutive successful checks before the connection is declared up again")
+	watchCmd.Flags().DurationVar(&suspectInterval, "suspect-interval", 5*time.Second, "The interval between checks while the connection state is changing")
+	watchCmd.Flags().StringVar(&stateDir, "state-dir", defaultStateDir(), "The directory the watch state is saved to across restarts")
+	watchCmd.Flags().StringArrayVar(&hooks, "hook", nil, "A command to run on an event, as \"event=command [args...]\". May be specified multiple times.")
+	watchCmd.Flags().DurationVar(&hookTimeout, "hook-timeout", 30*time.Second, "How long a hook command may run before it is killed")
+	watchCmd.Flags().StringArrayVar(&webhooks, "webhook", nil, "A URL to POST events to. May be specified multiple times.")
+	watchCmd.Flags().StringVar(&webhookTemplate, "webhook-template", "", "A file containing a Go template for webhook request bodies")
+	watchCmd.Flags().StringSliceVar(&webhookEvents, "webhook-events", eventNames(internal.DefaultNotifyEvents), "The events sent to webhooks, or \"*\" for every event")
+	watchCmd.Flags().DurationVar(&webhookMaxAge, "webhook-max-age", 24*time.Hour, "How long an event that could not be sent to a webhook is retried for")
+	watchCmd.Flags().StringVar(&smtpServer, "smtp-server", "", "The host:port of a mail server to email events through")
+	watchCmd.Flags().StringVar(&smtpSecurity, "smtp-security", string(internal.SMTPStartTLS), "How to secure the connection to the mail server: starttls, tls or none")
+	watchCmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "The user to authenticate to the mail server as")
+	watchCmd.Flags().StringVar(&smtpPassword, "smtp-password", "", "The password to authenticate to the mail server with (default $T11C_SMTP_PASSWORD)")
+	watchCmd.Flags().StringVar(&smtpFrom, "smtp-from", "", "The sender address of event emails")
+	watchCmd.Flags().StringSliceVar(&smtpTo, "smtp-to", nil, "The recipients of event emails")
+	watchCmd.Flags().StringSliceVar(&smtpEvents, "smtp-events", eventNames(internal.DefaultNotifyEvents), "The events emailed, or \"*\" for every event")
+	watchCmd.Flags().DurationVar(&smtpMaxAge, "smtp-max-age", 24*time.Hour, "How long an event that could not be emailed is retried for")
+	watchCmd.Flags().StringVar(&mqttBroker, "mqtt-broker", "", "The URL of an MQTT broker to publish the watch state to, e.g. tcp://localhost:1883")
+	watchCmd.Flags().StringVar(&mqttClientID, "mqtt-client-id", "t11c-reset", "The MQTT client ID, also used to identify the device to Home Assistant")
+	watchCmd.Flags().StringVar(&mqttUsername, "mqtt-username", "", "The user to authenticate to the MQTT broker as")
+	watchCmd.Flags().StringVar(&mqttPassword, "mqtt-password", "", "The password to authenticate to the MQTT broker with (default $T11C_MQTT_PASSWORD)")
+	watchCmd.Flags().StringVar(&mqttTopic, "mqtt-topic", "t11c-reset", "The prefix of the published MQTT topics")
+	watchCmd.Flags().StringVar(&mqttDiscoveryPrefix, "mqtt-discovery-prefix", "homeassistant", "The Home Assistant discovery prefix (empty disables discovery)")
+	watchCmd.Flags().BoolVar(&diagnose, "diagnose", false, "Localise faults before resetting, and only reset the modem for faults beyond the router")
+	watchCmd.Flags().StringVar(&linkInterface, "link-interface", "", "The local interface whose link is watched (default the interface used to reach the router)")
+	watchCmd.Flags().StringVar(&routerPing, "router-ping", "", "A remote host for the router to ping while diagnosing a fault (experimental, empty disables)")
+	watchCmd.Flags().StringSliceVar(&escalation, "escalation", []string{string(internal.ActionRedial)}, "The remediation steps taken on successive attempts, each as action[:max wait[:successes]] (retrain and reboot are experimental)")
+	watchCmd.Flags().StringVar(&powerCycleCommand, "power-cycle-command", "", "The command run by the power-cycle escalation step, e.g. to switch a smart plug off and on (split on spaces, quoting is not supported)")
+	watchCmd.Flags().IntVar(&retryAttempts, "retry-attempts", 0, "The number of consecutive failed resets before remediation gives up until the connection is next up (0 retries indefinitely at --retry-max-backoff)")
+	watchCmd.Flags().DurationVar(&retryBackoff, "retry-backoff", 30*time.Second, "The delay before retrying a failed reset, doubled after each further failure")
+	watchCmd.Flags().DurationVar(&retryMaxBackoff, "retry-max-backoff", 10*time.Minute, "The maximum delay between reset attempts")
+	watchCmd.Flags().StringArrayVar(&maintenance, "maintenance", nil, "A weekly window during which the modem is not reset, as \"[days] HH:MM-HH:MM [timezone]\". May be specified multiple times.")
+	watchCmd.Flags().StringVar(&reconnectSchedule, "reconnect-schedule", "", "A cron expression for proactive reconnects (empty disables them)")
+	watchCmd.Flags().DurationVar(&reconnectMinUptime, "reconnect-min-uptime", time.Hour, "How long the connection must have been up before a scheduled reconnect")
+	watchCmd.Flags().Float64Var(&reconnectIdleKbps, "reconnect-idle-kbps", 0, "The WAN traffic rate, in kbit/s, at or above which a scheduled reconnect waits (experimental, 0 ignores traffic)")
+	watchCmd.Flags().DurationVar(&reconnectIdleSample, "reconnect-idle-sample", 30*time.Second, "The minimum time over which WAN traffic is measured, across checks, before a scheduled reconnect")
+	watchCmd.Flags().DurationVar(&reconnectWindow, "reconnect-window", time.Hour, "How long a scheduled reconnect may wait for its conditions before it is skipped")
+	watchCmd.Flags().IntVar(&budgetPerHour, "max-resets-hour", 0, "The maximum number of resets in any hour (0 for no limit)")
+	watchCmd.Flags().IntVar(&budgetPerDay, "max-resets-day", 0, "The maximum number of resets in any day (0 for no limit)")
+	watchCmd.Flags().DurationVar(&budgetGap, "min-reset-gap", 0, "The minimum time between resets")
+	watchCmd.Flags().DurationVar(&routerTimeout, "router-timeout", 10*time.Second, "How long the router's web interface may take to respond to a health probe")
+	watchCmd.Flags().IntVar(&routerFailures, "router-failures", 3, "The number of consecutive failed health probes before the router is treated as unresponsive (0 disables the probe)")
+	watchCmd.Flags().StringVar(&routerAction, "router-action", "", "A command to run when the router becomes unresponsive, e.g. to power cycle it (split on spaces, quoting is not supported)")
+	watchCmd.Flags().IntVar(&demoteAfter, "demote-after", 3, "The number of consecutive checks a remote host may fail while others respond before it is demoted (0 never demotes)")
+	watchCmd.Flags().DurationVar(&demoteFor, "demote-for", 30*time.Minute, "How long a demoted remote host is excluded from checks")
+	watchCmd.Flags().DurationVar(&statusInterval, "status-interval", time.Hour, "The interval between status log lines (0 disables them)")
+	watchCmd.Flags().DurationVar(&dnsRefresh, "dns-refresh", 5*time.Minute, "How often hostname remote hosts are resolved again. The last known address is used while DNS is unavailable.")
+
+	watchCmd.Flags().StringSliceVar(&remoteHosts6, "remote6", nil, "The remote IPv6 address to ping to test IPv6 connectivity, optionally weighted as host=weight. May be specified multiple times.")
+	watchCmd.Flags().UintVar(&quorum6, "quorum6", 0, "The total weight of failed IPv6 remote hosts required to treat IPv6 connectivity as down (0 requires all hosts to fail)")
+	watchCmd.Flags().BoolVar(&ipv6Reset, "ipv6-reset", false, "Reset the modem when IPv6 connectivity is down, even if IPv4 is up")
+	watchCmd.Flags().IntVar(&ipv6ResetAfter, "ipv6-reset-after", 3, "The number of consecutive checks IPv6 connectivity must be down for before a reset")
+	watchCmd.Flags().DurationVar(&ipv6ResetPeriod, "ipv6-reset-interval", time.Hour, "The minimum time between resets caused by IPv6 connectivity")
+
+	watchCmd.Flags().IntVar(&recoverySuccesses, "recovery-successes", net.DefaultRecoveryPolicy.Successes, "The number of consecutive ping replies required before the connection is treated as restored after a reset")
+	watchCmd.Flags().BoolVar(&recoveryPerTarget, "recovery-per-target", false, "Require --recovery-successes replies from each responding remote host, rather than across all hosts")
+	watchCmd.Flags().IntVar(&recoveryTargets, "recovery-targets", net.DefaultRecoveryPolicy.MinTargets, "The number of remote hosts that must be responding before the connection is treated as restored")
+	watchCmd.Flags().DurationVar(&recoveryStable, "recovery-stable", 0, "How long the remote hosts must keep responding without loss before the connection is treated as restored")
+	watchCmd.Flags().DurationVar(&recoveryMaxWait, "recovery-max-wait", net.DefaultRecoveryPolicy.MaxWait, "How long to wait for the connection to be restored after a reset before reconnecting again")
+
+	watchCmd.Flags().IntVar(&mtuExpected, "mtu-expected", 0, "The IP packet size that should reach the first remote host without fragmentation (0 disables the MTU check)")
+	watchCmd.Flags().IntSliceVar(&mtuSizes, "mtu-sizes", net.DefaultMTUSizes, "The IP packet sizes to probe during the MTU check")
+	watchCmd.Flags().DurationVar(&mtuInterval, "mtu-interval", 30*time.Minute, "The minimum time between MTU checks")
+	watchCmd.Flags().BoolVar(&mtuReset, "mtu-reset", false, "Reset the modem when the MTU check finds a black hole")
+
+	addSpeedtestFlags(watchCmd)
+	watchCmd.Flags().DurationVar(&speedtestInterval, "speedtest-interval", 0, "The minimum time between throughput measurements (0 disables them)")
+	watchCmd.Flags().Float64Var(&speedtestMinMbps, "speedtest-min", 0, "The throughput, in Mbit/s, below which a measurement is considered slow")
+	watchCmd.Flags().IntVar(&speedtestRuns, "speedtest-runs", 3, "The number of consecutive slow measurements before the connection is considered slow")
+	watchCmd.Flags().BoolVar(&speedtestReset, "speedtest-reset", false, "Reset the modem when the connection is considered slow")
+
+	watchCmd.Flags().IntVar(&degradeWindow, "degrade-window", 10, "The number of recent checks over which connection quality is measured")
+	watchCmd.Flags().Float64Var(&degradeLoss, "degrade-loss", 0, "The packet loss percentage over the window above which the connection is degraded (0 disables)")
+	watchCmd.Flags().DurationVar(&degradeRtt, "degrade-rtt", 0, "The median round trip time over the window above which the connection is degraded (0 disables)")
+	watchCmd.Flags().DurationVar(&degradeJitter, "degrade-jitter", 0, "The jitter over the window above which the connection is degraded (0 disables)")
+	watchCmd.Flags().IntVar(&degradeChecks, "degrade-checks", 3, "The number of consecutive checks that must breach a limit before the connection is degraded")
+	watchCmd.Flags().BoolVar(&degradeReset, "degrade-reset", false, "Reset the modem when the connection is degraded")
+	watchCmd.Flags().DurationVar(&degradeResetPeriod, "degrade-reset-interval", time.Hour, "The minimum time between resets caused by a degraded connection")
+}
+
+func eventNames(kinds []internal.EventKind) []string {
+	names := make([]string, len(kinds))
+	for i, kind := range kinds {
+		names[i] = string(kind)
+	}
+	return names
+}
+
+func eventKinds(names []string) []internal.EventKind {
+	kinds := make([]internal.EventKind, len(names))
+	for i, name := range names {
+		kinds[i] = internal.EventKind(name)
+	}
+	return kinds
+}
+
+// notifyQueue returns the queue settings shared by the notifiers
+func notifyQueue(maxAge time.Duration) internal.QueueConfig {
+	return internal.QueueConfig{
+		Retry:  internal.RetryPolicy{Backoff: 5 * time.Second, MaxBackoff: 5 * time.Minute},
+		MaxAge: maxAge,
+		Size:   100,
+	}
+}
+
+// webhookConfig builds the settings shared by every webhook from the flags
+func webhookConfig() (internal.WebhookConfig, error) {
+	cfg := internal.WebhookConfig{
+		Events: eventKinds(webhookEvents),
+		Queue:  notifyQueue(webhookMaxAge),
+	}
+	if webhookTemplate == "" {
+		return cfg, nil
+	}
+
+	text, err := ioutil.ReadFile(webhookTemplate)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Template, err = internal.ParseWebhookTemplate(string(text))
+	return cfg, err
+}
+
+// smtpNotifier creates the email notifier from the flags
+func smtpNotifier() (*internal.SMTPNotifier, error) {
+	security, err := internal.ParseSMTPSecurity(smtpSecurity)
+	if err != nil {
+		return nil, err
+	}
+	password := smtpPassword
+	if password == "" {
+		password = os.Getenv("T11C_SMTP_PASSWORD")
+	}
+	return internal.NewSMTPNotifier(logger, internal.SMTPConfig{
+		Server:   smtpServer,
+		Security: security,
+		Username: smtpUsername,
+		Password: password,
+		From:     smtpFrom,
+		To:       smtpTo,
+		Events:   eventKinds(smtpEvents),
+		Queue:    notifyQueue(smtpMaxAge),
+	})
+}
+
+// mqttReporter creates the MQTT reporter from the flags
+func mqttReporter() *internal.MQTT {
+	password := mqttPassword
+	if password == "" {
+		password = os.Getenv("T11C_MQTT_PASSWORD")
+	}
+	return internal.NewMQTT(logger, internal.MQTTConfig{
+		Broker:          mqttBroker,
+		ClientID:        mqttClientID,
+		Username:        mqttUsername,
+		Password:        password,
+		Topic:           strings.TrimSuffix(mqttTopic, "/"),
+		DiscoveryPrefix: strings.TrimSuffix(mqttDiscoveryPrefix, "/"),
+		Retry:           notifyQueue(0).Retry,
+	})
 }
@@ -3,18 +3,17 @@ module github.com/ks07/t11c-reset
 go 1.15
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/go-kit/kit v0.10.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.8.1
-	github.com/sparrc/go-ping v0.0.0-20190613174326-4e5b6552494c
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.6.1
 	golang.org/x/net v0.0.0-20200822124328-c89045814202
-	golang.org/x/sys v0.0.0-20200821140526-fda516888d29 // indirect
+	golang.org/x/sys v0.0.0-20200821140526-fda516888d29
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
-
-replace github.com/sparrc/go-ping => github.com/voidint/go-ping v0.0.0-20200322071507-b648e00b1fd9
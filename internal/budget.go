@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResetBudget limits how often the modem may be reset, so that a long outage does not cause a stream of redials
+type ResetBudget struct {
+	PerHour int           // The maximum number of resets in any hour, or 0 for no limit
+	PerDay  int           // The maximum number of resets in any day, or 0 for no limit
+	MinGap  time.Duration // The minimum time between resets
+}
+
+// resetLimiter enforces a ResetBudget over the times of recent resets
+type resetLimiter struct {
+	budget ResetBudget
+	resets []time.Time // The times of the resets in the last day, oldest first
+}
+
+// allow returns the time until the next reset is allowed, with the reason it is not allowed now, or zero if a reset
+// is allowed now
+func (l *resetLimiter) allow(now time.Time) (time.Duration, string) {
+	l.expire(now)
+	if len(l.resets) == 0 {
+		return 0, ""
+	}
+
+	var wait time.Duration
+	var reason string
+	limit := func(until time.Time, why string) {
+		if d := until.Sub(now); d > wait {
+			wait, reason = d, why
+		}
+	}
+
+	if l.budget.MinGap > 0 {
+		limit(l.resets[len(l.resets)-1].Add(l.budget.MinGap), fmt.Sprintf("less than %s since the last reset", l.budget.MinGap))
+	}
+	if n := l.budget.PerHour; n > 0 {
+		if recent := l.since(now.Add(-time.Hour)); len(recent) >= n {
+			limit(recent[len(recent)-n].Add(time.Hour), fmt.Sprintf("%d resets in the last hour", len(recent)))
+		}
+	}
+	if n := l.budget.PerDay; n > 0 && len(l.resets) >= n {
+		limit(l.resets[len(l.resets)-n].Add(24*time.Hour), fmt.Sprintf("%d resets in the last day", len(l.resets)))
+	}
+	return wait, reason
+}
+
+// record notes that a reset was made
+func (l *resetLimiter) record(now time.Time) {
+	l.resets = append(l.resets, now)
+	l.expire(now)
+}
+
+// since returns the resets made after t
+func (l *resetLimiter) since(t time.Time) []time.Time {
+	for i, at := range l.resets {
+		if at.After(t) {
+			return l.resets[i:]
+		}
+	}
+	return nil
+}
+
+func (l *resetLimiter) expire(now time.Time) {
+	l.resets = l.since(now.Add(-24 * time.Hour))
+}
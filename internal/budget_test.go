@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResetLimiter(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := &resetLimiter{budget: ResetBudget{PerHour: 2, PerDay: 3, MinGap: 10 * time.Minute}}
+
+	wait, _ := l.allow(now)
+	assert.Zero(t, wait, "The first reset should be allowed")
+	l.record(now)
+
+	wait, reason := l.allow(now.Add(time.Minute))
+	assert.Equal(t, 9*time.Minute, wait, "Resets should be spaced by the minimum gap")
+	assert.Contains(t, reason, "since the last reset")
+
+	l.record(now.Add(10 * time.Minute))
+	wait, reason = l.allow(now.Add(30 * time.Minute))
+	assert.Equal(t, 30*time.Minute, wait, "The hourly budget should be exhausted until the oldest reset is an hour old")
+	assert.Contains(t, reason, "last hour")
+
+	l.record(now.Add(time.Hour))
+	wait, reason = l.allow(now.Add(2 * time.Hour))
+	assert.Equal(t, 22*time.Hour, wait, "The daily budget should be exhausted until the oldest reset is a day old")
+	assert.Contains(t, reason, "last day")
+
+	wait, _ = l.allow(now.Add(24*time.Hour + time.Second))
+	assert.Zero(t, wait, "Resets older than a day should no longer count")
+	assert.Len(t, l.resets, 2)
+}
+
+func TestResetSuppressed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var dials []string
+	router := fakeRouter(t, func(flag string) {
+		dials = append(dials, flag)
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{
+		Retry:  RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+		Budget: ResetBudget{MinGap: time.Hour},
+	})
+
+	w.checkReset(ctx)
+	assert.Equal(t, []string{"2", "1"}, dials, "Retries within the minimum gap should be suppressed")
+	assert.True(t, w.suppressed)
+	assert.False(t, w.gaveUp, "A suppressed reset should not count as giving up")
+
+	w.checkReset(ctx)
+	assert.Len(t, dials, 2, "Monitoring should only observe while the budget is exhausted")
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	stdnet "net"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+// Layer identifies the part of the path to the internet at which a fault was found
+type Layer int
+
+const (
+	LayerUnknown  Layer = iota // The fault could not be localised
+	LayerLocal                 // The monitoring host's own interface is down
+	LayerRouter                // The router's web interface is not responding
+	LayerLAN                   // The router can reach the internet itself, but the monitoring host cannot
+	LayerPPP                   // The router has no PPP link, or its gateway does not respond
+	LayerInternet              // The PPP gateway responds, but the remote hosts do not
+)
+
+func (l Layer) String() string {
+	switch l {
+	case LayerLocal:
+		return "local"
+	case LayerRouter:
+		return "router"
+	case LayerLAN:
+		return "lan"
+	case LayerPPP:
+		return "ppp"
+	case LayerInternet:
+		return "internet"
+	default:
+		return "unknown"
+	}
+}
+
+// WANSide returns true if the fault lies beyond the router, where reconnecting the modem may help
+func (l Layer) WANSide() bool {
+	return l == LayerPPP || l == LayerInternet || l == LayerUnknown
+}
+
+const routerPingCount = 3 // The number of pings sent by the router's diagnostics page
+
+// routerPing pings host from the router's diagnostics page, for router-ping targets. Targets are probed concurrently,
+// so requests to the router are made one at a time.
+func (w *watcher) routerPing(ctx context.Context, host string, count int) (int, int, time.Duration, error) {
+	w.routerPingMu.Lock()
+	defer w.routerPingMu.Unlock()
+
+	if err := w.ensureSession(ctx); err != nil {
+		return 0, 0, 0, err
+	}
+	result, err := w.conn.DiagnosticPing(ctx, host, count)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return result.Transmitted, result.Received, result.AvgRtt, nil
+}
+
+// diagnose escalates through each layer between the monitoring host and the internet, returning the first that fails
+func (w *watcher) diagnose(ctx context.Context) Layer {
+	if link, err := w.linkState(); err != nil {
+		level.Warn(w.logger).Log("msg", "failed to read local link state", "err", err)
+	} else if !link.Up() {
+		level.Debug(w.logger).Log("msg", "local interface is down", "interface", link.Interface, "operstate", link.OperState, "carrier", link.Carrier)
+		return LayerLocal
+	}
+
+	if _, err := w.conn.Reachable(ctx); err != nil {
+		level.Debug(w.logger).Log("msg", "router is unreachable", "err", err)
+		return LayerRouter
+	}
+
+	// The router responds but cannot be asked about its WAN link, so the fault may still be beyond it
+	if err := w.ensureSession(ctx); err != nil {
+		level.Debug(w.logger).Log("msg", "failed to log in to router", "err", err)
+		return LayerUnknown
+	}
+	status, err := w.conn.WANStatus(ctx)
+	if err != nil {
+		level.Debug(w.logger).Log("msg", "failed to read router status", "err", err)
+		return LayerUnknown
+	}
+
+	if !status.Connected() || status.Gateway == nil || status.Gateway.IsUnspecified() {
+		level.Debug(w.logger).Log("msg", "router reports no PPP link", "wan_ip", status.IP, "gateway", status.Gateway)
+		return LayerPPP
+	}
+
+	if w.cfg.RouterPing != "" {
+		routerPing, err := w.conn.DiagnosticPing(ctx, w.cfg.RouterPing, routerPingCount)
+		if err != nil {
+			level.Warn(w.logger).Log("msg", "failed to ping from router", "remote_host", w.cfg.RouterPing, "err", err)
+		} else {
+			level.Debug(w.logger).Log("msg", "pinged from router", "result", routerPing)
+			if !routerPing.Failed() {
+				return LayerLAN
+			}
+		}
+	}
+
+	gateway := w.checker.Probe(ctx, net.Target{Host: status.Gateway.String(), Weight: 1, IPv6: status.Gateway.To4() == nil})
+	level.Debug(w.logger).Log("msg", "pinged PPP gateway", "result", gateway)
+	if gateway.Failed() {
+		return LayerPPP
+	}
+
+	return LayerInternet
+}
+
+// linkState reads the state of the interface used to reach the router: the configured interface, the bound interface,
+// or else the interface the router is routed through
+func (w *watcher) linkState() (net.LinkState, error) {
+	if w.cfg.LinkInterface != "" {
+		return w.readLinkState(w.cfg.LinkInterface)
+	}
+	if w.cfg.Ping.Binding.Interface != "" {
+		return w.readLinkState(w.cfg.Ping.Binding.Interface)
+	}
+
+	routerHost := w.conn.Hostname
+	if host, _, err := stdnet.SplitHostPort(routerHost); err == nil {
+		routerHost = host
+	}
+	iface, err := w.interfaceFor(routerHost)
+	if err != nil {
+		if w.linkInterface == "" {
+			return net.LinkState{}, err
+		}
+		// Pulling the cable removes the address and route along with the link, so fall back to the last interface
+		level.Debug(w.logger).Log("msg", "failed to find the interface used to reach the router, reading the last one", "interface", w.linkInterface, "err", err)
+		return w.readLinkState(w.linkInterface)
+	}
+
+	if w.linkInterface != "" && iface.Name != w.linkInterface {
+		// Without its link, traffic to the router may be routed through another interface, e.g. a backup link
+		if last, err := w.readLinkState(w.linkInterface); err == nil && !last.Up() {
+			return last, nil
+		}
+		level.Info(w.logger).Log("msg", "interface used to reach the router changed", "from", w.linkInterface, "to", iface.Name)
+	}
+	w.linkInterface = iface.Name
+	return w.readLinkState(iface.Name)
+}
+
+// checkLink emits an event when the local link changes state, and returns false while the link is down or its state
+// cannot be read
+func (w *watcher) checkLink() bool {
+	link, err := w.linkState()
+	if err != nil {
+		// An unknown link is not assumed to be up, as our own unplugged cable must not lead to resets or router actions
+		if !w.linkUnknown {
+			w.linkUnknown = true
+			level.Warn(w.logger).Log("msg", "failed to read local link state, pausing remediation", "err", err)
+		}
+		return false
+	}
+	if w.linkUnknown {
+		w.linkUnknown = false
+		level.Info(w.logger).Log("msg", "local link state is known again", "interface", link.Interface, "operstate", link.OperState)
+	}
+
+	if link.Up() == w.linkDown {
+		w.linkDown = !link.Up()
+		if w.linkDown {
+			w.emit(EventLinkDown, "local link is down, pausing remediation", "interface", link.Interface, "operstate", link.OperState)
+		} else {
+			w.emit(EventLinkUp, "local link is up, resuming remediation", "interface", link.Interface, "operstate", link.OperState)
+		}
+	}
+	return !w.linkDown
+}
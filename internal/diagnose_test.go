@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+const statusViewTemplate = `<html><body><table>
+<tr><td id="DeviceInfo_WanIP">%s</td></tr>
+<tr><td id="DeviceInfo_gateway">%s</td></tr>
+</table></body></html>`
+
+const diagnosticPingTemplate = `<html><body><textarea id="PingResult">
+3 packets transmitted, %d packets received
+</textarea></body></html>`
+
+func TestDiagnose(t *testing.T) {
+	ctx := context.Background()
+	wanIP, gateway := "0.0.0.0", "0.0.0.0"
+	routerPingReplies := 0
+	statusFails := true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/pages/statusview.cgi", func(w http.ResponseWriter, r *http.Request) {
+		if statusFails {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, statusViewTemplate, wanIP, gateway)
+	})
+	mux.HandleFunc("/cgi-bin/pages/maintenance/diagnostics/ping.cgi", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, diagnosticPingTemplate, routerPingReplies)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router := httptest.NewServer(mux)
+	w := testWatcher(t, router, WatchConfig{Diagnose: true, RouterPing: "192.0.2.1"})
+
+	assert.Equal(t, LayerUnknown, w.diagnose(ctx), "A router whose status cannot be read should be an unknown fault")
+	assert.True(t, LayerUnknown.WANSide(), "Unknown faults should still cause a reset")
+
+	statusFails = false
+	assert.Equal(t, LayerPPP, w.diagnose(ctx), "A router without a WAN address should be a PPP fault")
+
+	wanIP = "192.0.2.138"
+	assert.Equal(t, LayerPPP, w.diagnose(ctx), "A router without a gateway should be a PPP fault")
+	assert.True(t, LayerPPP.WANSide())
+
+	gateway = "198.51.100.200"
+	routerPingReplies = 3
+	assert.Equal(t, LayerLAN, w.diagnose(ctx), "Remote hosts that answer the router should be a LAN fault")
+	assert.False(t, LayerLAN.WANSide(), "LAN faults should not cause a reset")
+
+	router.Close()
+	assert.Equal(t, LayerRouter, w.diagnose(ctx), "An unresponsive router should be a router fault")
+	assert.False(t, LayerRouter.WANSide(), "Router faults should not cause a reset")
+	assert.False(t, LayerLocal.WANSide(), "Local faults should not cause a reset")
+}
+
+func TestCheckLink(t *testing.T) {
+	router := httptest.NewServer(http.NotFoundHandler())
+	defer router.Close()
+	w := testWatcher(t, router, WatchConfig{Diagnose: true, RouterPing: "192.0.2.1"})
+
+	route := &stdnet.Interface{Name: "eth0"}
+	var routeErr error
+	links := map[string]net.LinkState{
+		"eth0":  {Interface: "eth0", OperState: "up", Carrier: true},
+		"wlan0": {Interface: "wlan0", OperState: "up", Carrier: true},
+	}
+	w.interfaceFor = func(host string) (*stdnet.Interface, error) {
+		return route, routeErr
+	}
+	w.readLinkState = func(iface string) (net.LinkState, error) {
+		state, ok := links[iface]
+		if !ok {
+			return state, errors.New("no such interface")
+		}
+		return state, nil
+	}
+
+	assert.True(t, w.checkLink())
+	assert.Equal(t, "eth0", w.linkInterface, "The interface used to reach the router should be remembered")
+
+	// Unplugging the cable removes the route to the router along with the link
+	links["eth0"] = net.LinkState{Interface: "eth0", OperState: "down"}
+	routeErr = errors.New("network is unreachable")
+	assert.False(t, w.checkLink(), "The remembered interface should be read when the route is gone")
+	assert.True(t, w.linkDown)
+
+	// Or the route moves to another interface
+	routeErr = nil
+	route = &stdnet.Interface{Name: "wlan0"}
+	assert.False(t, w.checkLink(), "The remembered interface should be read when the route moves away from it")
+	assert.Equal(t, "eth0", w.linkInterface)
+
+	links["eth0"] = net.LinkState{Interface: "eth0", OperState: "up", Carrier: true}
+	assert.True(t, w.checkLink())
+	assert.False(t, w.linkDown)
+	assert.Equal(t, "wlan0", w.linkInterface, "The route should be followed while the remembered interface is up")
+
+	w.linkInterface = ""
+	routeErr = errors.New("network is unreachable")
+	assert.False(t, w.checkLink(), "An unknown link should not be treated as up")
+	assert.True(t, w.linkUnknown)
+	assert.False(t, w.linkDown)
+}
+
+func TestRouterPingTarget(t *testing.T) {
+	routerPingReplies, routerPings := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/pages/maintenance/diagnostics/ping.cgi", func(w http.ResponseWriter, r *http.Request) {
+		routerPings++
+		fmt.Fprintf(w, diagnosticPingTemplate, routerPingReplies)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router := httptest.NewServer(mux)
+	defer router.Close()
+
+	targets, err := net.ParseTargets([]string{"router-ping:192.0.2.1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := testWatcher(t, router, WatchConfig{Ping: net.PingConfig{Targets: targets}})
+
+	result, err := w.checker.CheckRemoteConnectivity(context.Background(), w.logger)
+	assert.NoError(t, err)
+	assert.False(t, result.Up, "The connection should be down when the router's pings are not answered")
+
+	routerPingReplies = 3
+	result, err = w.checker.CheckRemoteConnectivity(context.Background(), w.logger)
+	assert.NoError(t, err)
+	assert.True(t, result.Up, "The connection should be up when the router's pings are answered")
+
+	pings := routerPings
+	w.checker.SkipRouter = true
+	_, _ = w.checker.CheckRemoteConnectivity(context.Background(), w.logger)
+	assert.Equal(t, pings, routerPings, "Router-ping targets should be skipped while the router is left alone")
+}
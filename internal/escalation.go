@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+// EscalationAction is a remediation that can be taken at a step of the escalation ladder
+type EscalationAction string
+
+const (
+	ActionRedial     EscalationAction = "redial"      // Disconnect and reconnect the PPP session
+	ActionRetrain    EscalationAction = "retrain"     // Retrain the DSL line
+	ActionReboot     EscalationAction = "reboot"      // Reboot the router
+	ActionPowerCycle EscalationAction = "power-cycle" // Run the external power cycle command
+	ActionAlert      EscalationAction = "alert"       // Raise an alert and stop remediating
+)
+
+// EscalationStep is a single step of the escalation ladder, with the criteria for the connection to count as restored
+// after it. Zero values use the configured recovery policy.
+type EscalationStep struct {
+	Action    EscalationAction
+	MaxWait   time.Duration // How long to wait for the connection to be restored after the action
+	Successes int           // The number of consecutive ping replies required
+}
+
+// DefaultEscalation redials on every attempt
+var DefaultEscalation = []EscalationStep{{Action: ActionRedial}}
+
+// ParseEscalationStep parses a step in the form "action[:max wait[:successes]]", e.g. "reboot:5m:5"
+func ParseEscalationStep(s string) (EscalationStep, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	step := EscalationStep{Action: EscalationAction(parts[0])}
+	switch step.Action {
+	case ActionRedial, ActionRetrain, ActionReboot, ActionPowerCycle, ActionAlert:
+	default:
+		return step, fmt.Errorf("invalid escalation step %q: unknown action %q", s, parts[0])
+	}
+
+	if len(parts) > 3 {
+		return step, fmt.Errorf("invalid escalation step %q: too many fields", s)
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		wait, err := time.ParseDuration(parts[1])
+		if err != nil || wait <= 0 {
+			return step, fmt.Errorf("invalid escalation step %q: wait must be a positive duration", s)
+		}
+		step.MaxWait = wait
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		successes, err := strconv.Atoi(parts[2])
+		if err != nil || successes <= 0 {
+			return step, fmt.Errorf("invalid escalation step %q: successes must be a positive integer", s)
+		}
+		step.Successes = successes
+	}
+	return step, nil
+}
+
+// ParseEscalation parses each of the given strings with ParseEscalationStep
+func ParseEscalation(ss []string) ([]EscalationStep, error) {
+	steps := make([]EscalationStep, 0, len(ss))
+	for _, s := range ss {
+		step, err := ParseEscalationStep(s)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// escalationStep returns the step of the ladder for the given attempt. The last step is repeated once the ladder is
+// exhausted.
+func (w *watcher) escalationStep(attempt int) EscalationStep {
+	ladder := w.cfg.Escalation
+	if len(ladder) == 0 {
+		ladder = DefaultEscalation
+	}
+	if attempt > len(ladder) {
+		attempt = len(ladder)
+	}
+	return ladder[attempt-1]
+}
+
+// RecoveryPolicy returns the policy for waiting for the connection after the step, with its overrides applied to base
+func (s EscalationStep) RecoveryPolicy(base net.RecoveryPolicy) net.RecoveryPolicy {
+	if s.MaxWait > 0 {
+		base.MaxWait = s.MaxWait
+	}
+	if s.Successes > 0 {
+		base.Successes = s.Successes
+	}
+	return base
+}
+
+// runStep takes the action of an escalation step, then waits for the connection to be restored
+func (w *watcher) runStep(ctx context.Context, step EscalationStep) error {
+	switch step.Action {
+	case ActionRedial:
+		if err := w.ensureSession(ctx); err != nil {
+			return err
+		}
+		if err := w.conn.SetModemState(ctx, false); err != nil {
+			// If explicit disconnection fails, just attempt to connect anyway
+			level.Warn(w.logger).Log("msg", "failed to disconnect, will try reconnect alone", "err", err)
+		}
+		if err := w.conn.SetModemState(ctx, true); err != nil {
+			level.Error(w.logger).Log("msg", "failed to reconnect modem", "err", err)
+			return err
+		}
+	case ActionRetrain:
+		if err := w.ensureSession(ctx); err != nil {
+			return err
+		}
+		if err := w.conn.RetrainDSL(ctx); err != nil {
+			return err
+		}
+	case ActionReboot:
+		if err := w.ensureSession(ctx); err != nil {
+			return err
+		}
+		if err := w.conn.Reboot(ctx); err != nil {
+			return err
+		}
+	case ActionPowerCycle:
+		if len(w.cfg.PowerCycle) == 0 {
+			return errors.New("no power cycle command configured")
+		}
+		if err := w.runCommand(ctx, "power cycle command", w.cfg.PowerCycle); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported remediation action %q", step.Action)
+	}
+
+	policy := step.RecoveryPolicy(w.checker.Recovery)
+	level.Info(w.logger).Log("msg", "remediation action complete, waiting for connectivity", "action", step.Action, "max_wait", policy.MaxWait)
+	return w.checker.WaitForRecovery(ctx, w.logger, policy)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+func TestParseEscalationStep(t *testing.T) {
+	step, err := ParseEscalationStep("redial")
+	assert.NoError(t, err)
+	assert.Equal(t, EscalationStep{Action: ActionRedial}, step)
+
+	step, err = ParseEscalationStep("reboot:5m:4")
+	assert.NoError(t, err)
+	assert.Equal(t, EscalationStep{Action: ActionReboot, MaxWait: 5 * time.Minute, Successes: 4}, step)
+
+	step, err = ParseEscalationStep("power-cycle::3")
+	assert.NoError(t, err)
+	assert.Equal(t, EscalationStep{Action: ActionPowerCycle, Successes: 3}, step, "An empty wait should use the default")
+
+	for _, s := range []string{"", "restart", "redial:soon", "redial:-1m", "redial:1m:0", "redial:1m:2:3"} {
+		_, err = ParseEscalationStep(s)
+		assert.Error(t, err, "Should reject %q", s)
+	}
+}
+
+func TestEscalationStepRecoveryPolicy(t *testing.T) {
+	base := net.RecoveryPolicy{Successes: 2, StableFor: time.Minute, MaxWait: 5 * time.Minute}
+	assert.Equal(t, base, EscalationStep{Action: ActionRedial}.RecoveryPolicy(base), "A step without overrides should use the base policy")
+
+	policy := EscalationStep{Action: ActionReboot, MaxWait: 30 * time.Second, Successes: 4}.RecoveryPolicy(base)
+	assert.Equal(t, net.RecoveryPolicy{Successes: 4, StableFor: time.Minute, MaxWait: 30 * time.Second}, policy)
+	assert.Error(t, policy.Validate(), "A step that waits for less than the stable time should be invalid")
+}
+
+func TestResetEscalates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var actions []string
+	router := fakeRouter(t, func(action string) {
+		actions = append(actions, action)
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{
+		Retry:      RetryPolicy{Backoff: time.Millisecond},
+		Escalation: []EscalationStep{{Action: ActionRedial}, {Action: ActionRetrain}, {Action: ActionReboot}, {Action: ActionPowerCycle}, {Action: ActionAlert}},
+	})
+
+	w.checkReset(ctx)
+	assert.Equal(t, []string{"2", "1", "retrain", "reboot"}, actions, "Each failed step should escalate to the next")
+	assert.True(t, w.gaveUp, "Remediation should stop at the alert step")
+
+	w.cfg.Escalation = []EscalationStep{{Action: ActionRetrain}}
+	w.cfg.Retry.MaxAttempts = 3
+	w.gaveUp = false
+	w.attempts = 0
+	actions = nil
+	w.reset(ctx)
+	assert.Equal(t, []string{"retrain", "retrain", "retrain"}, actions, "The last step should repeat once the ladder is exhausted")
+}
+
+func TestResetResumesEscalation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var actions []string
+	router := fakeRouter(t, func(action string) {
+		actions = append(actions, action)
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{
+		Retry:      RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+		Budget:     ResetBudget{MinGap: time.Hour},
+		Escalation: []EscalationStep{{Action: ActionRedial}, {Action: ActionRetrain}, {Action: ActionReboot}},
+	})
+
+	w.checkReset(ctx)
+	assert.Equal(t, []string{"2", "1"}, actions, "The budget should interrupt remediation after the first step")
+
+	// Once the budget allows it, remediation should carry on up the ladder rather than start again
+	w.limiter.budget = ResetBudget{}
+	w.checkReset(ctx)
+	assert.Equal(t, []string{"2", "1", "retrain", "reboot"}, actions, "Remediation should resume from the next step")
+	assert.True(t, w.gaveUp, "The maximum attempts should count steps taken before the interruption")
+
+	w.declareUp(time.Now(), "checks")
+	assert.Zero(t, w.attempts, "The ladder should restart once the connection is up")
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// EventKind identifies a notable change observed by the watch loop
+type EventKind string
+
+const (
+	EventLinkDown EventKind = "link_down" // The local interface lost its link
+	EventLinkUp   EventKind = "link_up"   // The local interface regained its link
+
+	EventConnectionDown EventKind = "connection_down" // Enough consecutive checks failed to declare the connection down
+	EventConnectionUp   EventKind = "connection_up"   // The connection was declared up again, by checks or a reset
+
+	EventRouterUnresponsive EventKind = "router_unresponsive" // The router's web interface stopped responding
+	EventRouterResponsive   EventKind = "router_responsive"   // The router's web interface is responding again
+
+	EventResetStarted      EventKind = "reset_started"       // A remediation action is about to be taken
+	EventRemediationStep   EventKind = "remediation_step"    // A step of the escalation ladder finished, successfully or not
+	EventRemediationGaveUp EventKind = "remediation_gave_up" // Remediation failed too many times, or reached the alert step
+	EventResetSuppressed   EventKind = "reset_suppressed"    // A reset was needed, but the reset budget is exhausted
+
+	EventScheduledReconnect EventKind = "scheduled_reconnect" // A scheduled reconnect finished, successfully or not
+	EventScheduledSkipped   EventKind = "scheduled_skipped"   // A scheduled reconnect was skipped as its conditions were not met
+	EventRequestedReconnect EventKind = "requested_reconnect" // A reconnect requested by a command finished, or was refused
+
+	EventMaintenanceStart EventKind = "maintenance_start" // A maintenance window or pause started
+	EventMaintenanceEnd   EventKind = "maintenance_end"   // A maintenance window or pause ended
+
+	EventMTUBlackHole  EventKind = "mtu_black_hole" // Packets below the expected MTU are being dropped
+	EventThroughputLow EventKind = "throughput_low" // Throughput has been below the minimum for consecutive measurements
+)
+
+// Event is a notable change observed by the watch loop, with details describing it
+type Event struct {
+	Kind    EventKind         `json:"kind"`
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details"`
+}
+
+// Notifier is told of each event emitted by the watch loop. Notify must not block the loop.
+type Notifier interface {
+	Notify(ev Event)
+	// Close waits for any notifications that are still being delivered
+	Close()
+}
+
+// emit records an event, with details given as alternating keys and values
+func (w *watcher) emit(kind EventKind, message string, details ...string) {
+	ev := Event{
+		Kind:    kind,
+		Time:    time.Now(),
+		Message: message,
+		Details: make(map[string]string, len(details)/2),
+	}
+	keyvals := []interface{}{"event", string(kind), "msg", message}
+	for i := 0; i+1 < len(details); i += 2 {
+		ev.Details[details[i]] = details[i+1]
+		keyvals = append(keyvals, details[i], details[i+1])
+	}
+
+	level.Info(w.logger).Log(keyvals...)
+	for _, n := range w.cfg.Notifiers {
+		n.Notify(ev)
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Hook is an external command run when an event is emitted
+type Hook struct {
+	Event   EventKind // The event that runs the command, or "*" for every event
+	Command []string
+}
+
+// ParseHook parses a hook in the form "event=command [args...]", e.g. "connection_up=systemctl restart openvpn"
+func ParseHook(s string) (Hook, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return Hook{}, fmt.Errorf("invalid hook %q: expected event=command", s)
+	}
+	h := Hook{Event: EventKind(strings.TrimSpace(s[:i])), Command: strings.Fields(s[i+1:])}
+	if len(h.Command) == 0 {
+		return Hook{}, fmt.Errorf("invalid hook %q: missing command", s)
+	}
+	return h, nil
+}
+
+// ParseHooks parses each of the given strings with ParseHook
+func ParseHooks(ss []string) ([]Hook, error) {
+	hooks := make([]Hook, 0, len(ss))
+	for _, s := range ss {
+		h, err := ParseHook(s)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// HookRunner is a Notifier that runs external commands in the background. Each command is given the event as JSON on
+// stdin, and as T11C_EVENT, T11C_MESSAGE, T11C_TIME and a T11C_ variable for each detail in its environment.
+type HookRunner struct {
+	logger  log.Logger
+	hooks   []Hook
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// NewHookRunner creates a HookRunner, which kills commands that run for longer than timeout
+func NewHookRunner(logger log.Logger, hooks []Hook, timeout time.Duration) *HookRunner {
+	return &HookRunner{logger: logger, hooks: hooks, timeout: timeout}
+}
+
+func (hr *HookRunner) Notify(ev Event) {
+	for _, h := range hr.hooks {
+		if h.Event != ev.Kind && h.Event != "*" {
+			continue
+		}
+		hr.wg.Add(1)
+		go func(h Hook) {
+			defer hr.wg.Done()
+			hr.run(h, ev)
+		}(h)
+	}
+}
+
+func (hr *HookRunner) Close() {
+	hr.wg.Wait()
+}
+
+func (hr *HookRunner) run(h Hook, ev Event) {
+	stdin, err := json.Marshal(ev)
+	if err != nil {
+		level.Error(hr.logger).Log("msg", "failed to encode event for hook", "event", ev.Kind, "err", err)
+		return
+	}
+
+	// Hooks are not tied to the watch context, so that they still run for the events emitted while shutting down
+	ctx, cancel := context.WithTimeout(context.Background(), hr.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(), hookEnv(ev)...)
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	logger := log.With(hr.logger, "event", ev.Kind, "command", h.Command[0], "duration", time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		level.Warn(logger).Log("msg", "hook failed", "err", err, "output", string(out))
+		return
+	}
+	level.Info(logger).Log("msg", "hook complete", "output", string(out))
+}
+
+func hookEnv(ev Event) []string {
+	env := []string{
+		"T11C_EVENT=" + string(ev.Kind),
+		"T11C_MESSAGE=" + ev.Message,
+		"T11C_TIME=" + ev.Time.UTC().Format(time.RFC3339),
+	}
+	for k, v := range ev.Details {
+		env = append(env, "T11C_"+envName(k)+"="+v)
+	}
+	return env
+}
+
+// envName converts a detail key to an environment variable name, e.g. "remote_host" to "REMOTE_HOST"
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
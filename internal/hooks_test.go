@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHook(t *testing.T) {
+	h, err := ParseHook("connection_up=systemctl restart openvpn")
+	assert.NoError(t, err)
+	assert.Equal(t, Hook{Event: EventConnectionUp, Command: []string{"systemctl", "restart", "openvpn"}}, h)
+
+	for _, s := range []string{"", "connection_up", "=true", "connection_up= "} {
+		_, err = ParseHook(s)
+		assert.Error(t, err, "Should reject %q", s)
+	}
+}
+
+func TestHookRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "t11c-reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdinPath := filepath.Join(dir, "stdin")
+	envPath := filepath.Join(dir, "env")
+
+	hr := NewHookRunner(log.NewNopLogger(), []Hook{
+		{Event: EventConnectionDown, Command: []string{"sh", "-c", `cat > "$0"; echo "$T11C_EVENT $T11C_REMOTE_HOST" > "$1"`, stdinPath, envPath}},
+		{Event: "*", Command: []string{"sleep", "10"}},
+	}, 100*time.Millisecond)
+
+	ev := Event{Kind: EventConnectionDown, Time: time.Now().UTC(), Message: "connection is down", Details: map[string]string{"remote_host": "1.1.1.1"}}
+	start := time.Now()
+	hr.Notify(ev)
+	assert.True(t, time.Since(start) < 50*time.Millisecond, "Hooks should not block the caller")
+	hr.Close()
+	assert.True(t, time.Since(start) < 5*time.Second, "Hooks should be killed after the timeout")
+
+	env, err := ioutil.ReadFile(envPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "connection_down 1.1.1.1\n", string(env), "Details should be passed as environment variables")
+
+	stdin, err := ioutil.ReadFile(stdinPath)
+	assert.NoError(t, err)
+	var got Event
+	assert.NoError(t, json.Unmarshal(stdin, &got))
+	assert.Equal(t, ev.Kind, got.Kind, "The event should be passed as JSON on stdin")
+	assert.Equal(t, ev.Details, got.Details)
+}
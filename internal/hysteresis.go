@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Hysteresis controls how many consecutive checks it takes to change the declared state of the connection, so that
+// a single bad burst of pings does not cause a reset
+type Hysteresis struct {
+	DownAfter       int           // The number of consecutive failed checks before the connection is declared down
+	UpAfter         int           // The number of consecutive successful checks before a down connection is declared up
+	SuspectInterval time.Duration // The interval between checks while the state is changing, or 0 to use the usual interval
+}
+
+// connState is the declared state of the connection
+type connState int
+
+const (
+	stateUp         connState = iota // The connection is up
+	stateSuspect                     // The connection is up, but recent checks have failed
+	stateDown                        // The connection is down
+	stateRecovering                  // The connection is down, but recent checks have succeeded
+)
+
+func (s connState) String() string {
+	switch s {
+	case stateSuspect:
+		return "suspect"
+	case stateDown:
+		return "down"
+	case stateRecovering:
+		return "recovering"
+	default:
+		return "up"
+	}
+}
+
+// observe records the result of a check, declaring the connection down or up once enough consecutive checks agree
+func (w *watcher) observe(up bool, now time.Time) {
+	if up {
+		w.failures = 0
+		w.successes++
+	} else {
+		if w.failures == 0 {
+			w.firstFailure = now
+		}
+		w.failures++
+		w.successes = 0
+	}
+
+	switch w.state {
+	case stateUp, stateSuspect:
+		if up {
+			if w.state == stateSuspect {
+				level.Info(w.logger).Log("msg", "connection is no longer suspect")
+			}
+			w.state = stateUp
+		} else if w.failures >= w.cfg.Hysteresis.DownAfter {
+			w.state = stateDown
+			w.downSince = w.firstFailure
+			w.upSince = time.Time{}
+			w.emit(EventConnectionDown, "connection is down", "failures", strconv.Itoa(w.failures))
+		} else if w.state == stateUp {
+			w.state = stateSuspect
+			level.Info(w.logger).Log("msg", "connection is suspect", "failures", w.failures, "down_after", w.cfg.Hysteresis.DownAfter)
+		}
+	case stateDown, stateRecovering:
+		if !up {
+			w.state = stateDown
+		} else if w.successes >= w.cfg.Hysteresis.UpAfter {
+			w.declareUp(now, "checks")
+		} else {
+			w.state = stateRecovering
+			level.Info(w.logger).Log("msg", "connection is recovering", "successes", w.successes, "up_after", w.cfg.Hysteresis.UpAfter)
+		}
+	}
+}
+
+// declareUp marks a down connection as up, reporting how long the outage lasted
+func (w *watcher) declareUp(now time.Time, by string) {
+	w.attempts = 0
+	if w.state == stateUp || w.state == stateSuspect {
+		w.state = stateUp
+		return
+	}
+	w.state = stateUp
+	w.failures = 0
+	w.emit(EventConnectionUp, "connection is up", "restored_by", by, "outage", now.Sub(w.downSince).Round(time.Second).String())
+	w.downSince = time.Time{}
+}
+
+// interval returns the time until the next check, which is shorter while the state is changing
+func (w *watcher) interval() time.Duration {
+	if (w.state == stateSuspect || w.state == stateRecovering) && w.cfg.Hysteresis.SuspectInterval > 0 {
+		return w.cfg.Hysteresis.SuspectInterval
+	}
+	return time.Duration(w.cfg.Interval) * time.Second
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserve(t *testing.T) {
+	w := newWatcher(log.NewNopLogger(), nil, WatchConfig{
+		Interval:   15,
+		Hysteresis: Hysteresis{DownAfter: 3, UpAfter: 2, SuspectInterval: 5 * time.Second},
+	})
+	now := time.Now()
+	assert.Equal(t, stateUp, w.state)
+	assert.Equal(t, 15*time.Second, w.interval())
+
+	w.observe(false, now)
+	assert.Equal(t, stateSuspect, w.state, "A single failure should only make the connection suspect")
+	assert.Equal(t, 5*time.Second, w.interval(), "Suspect connections should be checked more often")
+	w.observe(true, now)
+	assert.Equal(t, stateUp, w.state, "A success should clear the suspicion")
+
+	w.observe(false, now)
+	w.observe(false, now.Add(5*time.Second))
+	assert.Equal(t, stateSuspect, w.state)
+	w.observe(false, now.Add(10*time.Second))
+	assert.Equal(t, stateDown, w.state, "Consecutive failures should declare the connection down")
+	assert.Equal(t, now, w.downSince, "The outage should start at the first failure")
+	assert.Equal(t, 15*time.Second, w.interval())
+
+	w.observe(true, now.Add(20*time.Second))
+	assert.Equal(t, stateRecovering, w.state)
+	w.observe(false, now.Add(25*time.Second))
+	assert.Equal(t, stateDown, w.state, "A failure should interrupt recovery")
+	w.observe(true, now.Add(30*time.Second))
+	w.observe(true, now.Add(35*time.Second))
+	assert.Equal(t, stateUp, w.state, "Consecutive successes should declare the connection up")
+	assert.True(t, w.downSince.IsZero())
+
+	// Without hysteresis, every check is decisive
+	w = newWatcher(log.NewNopLogger(), nil, WatchConfig{Interval: 15})
+	w.observe(false, now)
+	assert.Equal(t, stateDown, w.state)
+	w.observe(true, now)
+	assert.Equal(t, stateUp, w.state)
+}
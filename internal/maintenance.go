@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// MaintenanceWindow is a weekly period during which the modem must not be reset, e.g. working hours
+type MaintenanceWindow struct {
+	Days     [7]bool // The weekdays on which the window starts, indexed by time.Weekday
+	Start    int     // The start of the window, in minutes after midnight
+	End      int     // The end of the window, in minutes after midnight. A window ending before it starts runs overnight.
+	Location *time.Location
+	text     string
+}
+
+// ParseMaintenanceWindow parses a window in the form "[days] HH:MM-HH:MM [timezone]", where days is a comma separated
+// list of weekdays or weekday ranges, e.g. "Mon-Fri 09:00-17:30 Europe/London". Windows without days apply every day,
+// and windows without a timezone use the local time.
+func ParseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	w := MaintenanceWindow{Location: time.Local, text: strings.TrimSpace(s)}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 3 {
+		return w, fmt.Errorf("invalid maintenance window %q: expected [days] HH:MM-HH:MM [timezone]", s)
+	}
+
+	if !strings.Contains(fields[0], ":") {
+		if err := w.parseDays(fields[0]); err != nil {
+			return w, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+		}
+		fields = fields[1:]
+	} else {
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	}
+	if len(fields) == 0 {
+		return w, fmt.Errorf("invalid maintenance window %q: missing time range", s)
+	}
+
+	start, end, ok := cutLast(fields[0], "-")
+	var err error
+	if !ok {
+		return w, fmt.Errorf("invalid maintenance window %q: time range must be HH:MM-HH:MM", s)
+	}
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return w, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return w, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+
+	if len(fields) == 2 {
+		if w.Location, err = time.LoadLocation(fields[1]); err != nil {
+			return w, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+		}
+	} else if len(fields) > 2 {
+		return w, fmt.Errorf("invalid maintenance window %q: expected [days] HH:MM-HH:MM [timezone]", s)
+	}
+	return w, nil
+}
+
+// ParseMaintenanceWindows parses each of the given strings with ParseMaintenanceWindow
+func ParseMaintenanceWindows(ss []string) ([]MaintenanceWindow, error) {
+	windows := make([]MaintenanceWindow, 0, len(ss))
+	for _, s := range ss {
+		w, err := ParseMaintenanceWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func (w *MaintenanceWindow) parseDays(s string) error {
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		first, last, isRange := cutLast(part, "-")
+		from, ok := weekdays[first]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[last]; !ok {
+				return fmt.Errorf("unknown weekday %q", last)
+			}
+		}
+		// Ranges may wrap around the end of the week, e.g. "Fri-Mon"
+		for d := from; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	hours, minutes, ok := cutLast(s, ":")
+	h, herr := strconv.Atoi(hours)
+	m, merr := strconv.Atoi(minutes)
+	if !ok || herr != nil || merr != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Contains returns true if t falls within the window
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.Start < w.End {
+		return w.Days[day] && minute >= w.Start && minute < w.End
+	}
+	// Overnight windows belong to the day on which they start
+	previous := (day + 6) % 7
+	return (w.Days[day] && minute >= w.Start) || (w.Days[previous] && minute < w.End)
+}
+
+func (w MaintenanceWindow) String() string {
+	return w.text
+}
+
+// ReadPause returns the time until which remediation has been paused by the pause command, or the zero time if it is
+// not paused
+func ReadPause(path string) (time.Time, error) {
+	content, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+}
+
+// WritePause pauses remediation until the given time, or resumes it if the time is zero. The file is replaced
+// atomically, so that a symlink planted at path is replaced rather than followed.
+func WritePause(path string, until time.Time) error {
+	if until.IsZero() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(path, []byte(until.UTC().Format(time.RFC3339)+"\n"))
+}
+
+// checkMaintenance emits an event when a maintenance window or pause starts or ends, and returns true while remediation
+// is suppressed by one
+func (w *watcher) checkMaintenance(now time.Time) bool {
+	reason := w.maintenanceReason(now)
+	if (reason != "") != w.maintenance {
+		w.maintenance = reason != ""
+		if w.maintenance {
+			w.emit(EventMaintenanceStart, "maintenance started, observing only", "reason", reason)
+		} else {
+			w.emit(EventMaintenanceEnd, "maintenance ended, resuming remediation")
+		}
+	}
+	return w.maintenance
+}
+
+func (w *watcher) maintenanceReason(now time.Time) string {
+	if w.cfg.PauseFile != "" {
+		until, err := ReadPause(w.cfg.PauseFile)
+		if err != nil {
+			level.Warn(w.logger).Log("msg", "failed to read pause file", "path", w.cfg.PauseFile, "err", err)
+		} else if now.Before(until) {
+			return "paused until " + until.UTC().Format(time.RFC3339)
+		}
+	}
+
+	for _, window := range w.cfg.Maintenance {
+		if window.Contains(now) {
+			return "window " + window.String()
+		}
+	}
+	return ""
+}
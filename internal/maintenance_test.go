@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := ParseMaintenanceWindow("Mon-Wed,Fri 09:00-17:30 UTC")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{false, true, true, true, false, true, false}, w.Days)
+	assert.Equal(t, 9*60, w.Start)
+	assert.Equal(t, 17*60+30, w.End)
+	assert.Equal(t, time.UTC, w.Location)
+
+	w, err = ParseMaintenanceWindow("Fri-Mon 22:00-06:00")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, false, false, false, true, true}, w.Days, "Day ranges should wrap around the week")
+	assert.Equal(t, time.Local, w.Location)
+
+	w, err = ParseMaintenanceWindow("00:00-24:00")
+	assert.NoError(t, err)
+	assert.Equal(t, [7]bool{true, true, true, true, true, true, true}, w.Days, "Windows without days should apply every day")
+
+	for _, s := range []string{"", "Mon-Fri", "Mon-Fri 9-17", "Someday 09:00-17:00", "09:00-25:00", "09:00-17:00 Nowhere/City", "Mon 09:00-17:00 UTC extra"} {
+		_, err = ParseMaintenanceWindow(s)
+		assert.Error(t, err, "Should reject %q", s)
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	// 2020-06-01 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	w, err := ParseMaintenanceWindow("Mon-Fri 09:00-17:30 UTC")
+	assert.NoError(t, err)
+	assert.True(t, w.Contains(at(1, 9, 0)))
+	assert.True(t, w.Contains(at(1, 17, 29)))
+	assert.False(t, w.Contains(at(1, 17, 30)), "The end of the window should be exclusive")
+	assert.False(t, w.Contains(at(6, 12, 0)), "Saturday should not be in the window")
+
+	w, err = ParseMaintenanceWindow("Sun 22:00-06:00 UTC")
+	assert.NoError(t, err)
+	assert.True(t, w.Contains(at(7, 23, 0)))
+	assert.True(t, w.Contains(at(1, 5, 59)), "Overnight windows should continue into the next day")
+	assert.False(t, w.Contains(at(2, 5, 0)), "Overnight windows should only continue from the days they start")
+
+	w, err = ParseMaintenanceWindow("Mon 09:00-10:00 Asia/Tokyo")
+	assert.NoError(t, err)
+	assert.True(t, w.Contains(at(1, 0, 30)), "Windows should be evaluated in their timezone")
+}
+
+func TestPauseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t11c-reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pause")
+
+	until, err := ReadPause(path)
+	assert.NoError(t, err, "A missing pause file should not be an error")
+	assert.True(t, until.IsZero())
+
+	want := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, WritePause(path, want))
+	until, err = ReadPause(path)
+	assert.NoError(t, err)
+	assert.True(t, want.Equal(until))
+
+	assert.NoError(t, WritePause(path, time.Time{}))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "Resuming should remove the pause file")
+	assert.NoError(t, WritePause(path, time.Time{}), "Resuming when not paused should not be an error")
+
+	// A symlink planted at the path should be replaced, not written through
+	target := filepath.Join(dir, "target")
+	assert.NoError(t, ioutil.WriteFile(target, []byte("keep"), 0644))
+	if err := os.Symlink(target, path); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	assert.NoError(t, WritePause(path, want))
+	content, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "keep", string(content), "Pausing should not follow a symlink")
+	info, err := os.Lstat(path)
+	assert.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular(), "The symlink should be replaced by the pause file")
+}
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	mqttQoS     = 1
+	mqttTimeout = 10 * time.Second // How long a publish may take before it is logged as failed
+
+	mqttOnline  = "online"
+	mqttOffline = "offline" // Published by the broker as the last will if watch disconnects uncleanly
+	// haUnknown is shown as an unknown state by Home Assistant
+	haUnknown = "None"
+
+	mqttCommandReconnect = "reconnect"
+)
+
+// MQTTConfig configures publishing the watch state to an MQTT broker
+type MQTTConfig struct {
+	Broker          string // The broker URL, e.g. tcp://localhost:1883 or ssl://broker:8883
+	ClientID        string
+	Username        string
+	Password        string
+	Topic           string      // The prefix of the published topics
+	DiscoveryPrefix string      // The Home Assistant discovery prefix, or empty to not publish discovery payloads
+	Retry           RetryPolicy // How the first connection to the broker is retried. Later reconnects are automatic.
+}
+
+// MQTT is a StatusReporter that publishes the watch state to retained topics under a prefix, and events to its event
+// topic. A "reconnect" message on its command topic requests a reconnect.
+type MQTT struct {
+	logger    log.Logger
+	cfg       MQTTConfig
+	client    mqtt.Client
+	reconnect chan string
+	publisher func(topic string, retained bool, payload string)
+
+	mu        sync.Mutex
+	status    *Status           // The last reported state, republished when the broker reconnects
+	published map[string]string // The retained payloads published since connecting, to skip unchanged values
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMQTT creates an MQTT reporter, and connects to the broker in the background
+func NewMQTT(logger log.Logger, cfg MQTTConfig) *MQTT {
+	m := newMQTT(log.With(logger, "mqtt", cfg.Broker), cfg)
+	m.publisher = m.clientPublish
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetWill(m.topic("availability"), mqttOffline, mqttQoS, true).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(m.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			level.Warn(m.logger).Log("msg", "lost connection to MQTT broker", "err", err)
+		})
+	m.client = mqtt.NewClient(opts)
+
+	go m.connect()
+	return m
+}
+
+func newMQTT(logger log.Logger, cfg MQTTConfig) *MQTT {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MQTT{
+		logger:    logger,
+		cfg:       cfg,
+		reconnect: make(chan string, 1),
+		published: make(map[string]string),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+// Reconnects returns the reconnects requested on the command topic
+func (m *MQTT) Reconnects() <-chan string {
+	return m.reconnect
+}
+
+// connect makes the first connection to the broker, which the client does not retry itself
+func (m *MQTT) connect() {
+	defer close(m.done)
+	for attempt := 1; ; attempt++ {
+		token := m.client.Connect()
+		token.Wait()
+		if token.Error() == nil {
+			return
+		}
+
+		delay := m.cfg.Retry.delay(attempt)
+		level.Warn(m.logger).Log("msg", "failed to connect to MQTT broker", "attempt", attempt, "delay", delay, "err", token.Error())
+		if !sleepContext(m.ctx, delay) {
+			return
+		}
+	}
+}
+
+func (m *MQTT) onConnect(c mqtt.Client) {
+	level.Info(m.logger).Log("msg", "connected to MQTT broker")
+	token := c.Subscribe(m.topic("command"), mqttQoS, func(_ mqtt.Client, msg mqtt.Message) {
+		m.command(string(msg.Payload()))
+	})
+	go m.logFailure(token, m.topic("command"))
+	m.connected()
+}
+
+// connected publishes the discovery payloads and the last reported state to a new connection
+func (m *MQTT) connected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published = make(map[string]string)
+
+	m.publishRetained(m.topic("availability"), mqttOnline)
+	if m.cfg.DiscoveryPrefix != "" {
+		for _, e := range m.discovery() {
+			m.publishRetained(e.topic, e.payload)
+		}
+	}
+	if m.status != nil {
+		m.publishStatus(*m.status)
+	}
+}
+
+// command handles a message on the command topic
+func (m *MQTT) command(payload string) {
+	switch cmd := strings.ToLower(strings.TrimSpace(payload)); cmd {
+	case mqttCommandReconnect:
+		select {
+		case m.reconnect <- "mqtt":
+			level.Info(m.logger).Log("msg", "reconnect requested")
+		default:
+			level.Info(m.logger).Log("msg", "reconnect already requested")
+		}
+	default:
+		level.Warn(m.logger).Log("msg", "unknown MQTT command", "command", cmd)
+	}
+}
+
+func (m *MQTT) Report(s Status) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = &s
+	m.publishStatus(s)
+}
+
+func (m *MQTT) publishStatus(s Status) {
+	link := "up"
+	if !s.LinkUp {
+		link = "down"
+	}
+	wanIP := haUnknown
+	if s.WANIP != nil {
+		wanIP = s.WANIP.String()
+	}
+	latency := haUnknown
+	if s.Latency > 0 {
+		latency = strconv.FormatFloat(float64(s.Latency)/float64(time.Millisecond), 'f', 1, 64)
+	}
+
+	m.publishRetained(m.topic("state"), s.State)
+	m.publishRetained(m.topic("link"), link)
+	m.publishRetained(m.topic("wan_ip"), wanIP)
+	m.publishRetained(m.topic("latency"), latency)
+	m.publishRetained(m.topic("loss"), strconv.FormatFloat(s.Loss, 'f', 1, 64))
+	m.publishRetained(m.topic("resets"), strconv.Itoa(s.Resets))
+	m.publishRetained(m.topic("resets_24h"), strconv.Itoa(s.ResetsDay))
+}
+
+// publishRetained publishes a retained payload, unless it was already published on this connection
+func (m *MQTT) publishRetained(topic, payload string) {
+	if last, ok := m.published[topic]; ok && last == payload {
+		return
+	}
+	m.published[topic] = payload
+	m.publisher(topic, true, payload)
+}
+
+func (m *MQTT) Notify(ev Event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		level.Error(m.logger).Log("msg", "failed to encode event", "event", ev.Kind, "err", err)
+		return
+	}
+	m.publisher(m.topic("event"), false, string(payload))
+}
+
+// Close marks watch as offline, and disconnects from the broker
+func (m *MQTT) Close() {
+	m.cancel()
+	<-m.done
+	if !m.client.IsConnected() {
+		return
+	}
+	// The last will is only published if the connection is lost, not when it is closed cleanly
+	m.client.Publish(m.topic("availability"), mqttQoS, true, mqttOffline).WaitTimeout(mqttTimeout)
+	m.client.Disconnect(250)
+}
+
+func (m *MQTT) clientPublish(topic string, retained bool, payload string) {
+	// Publishing without a connection fails straight away, and the state is published again on connecting
+	if !m.client.IsConnected() {
+		return
+	}
+	go m.logFailure(m.client.Publish(topic, mqttQoS, retained, payload), topic)
+}
+
+func (m *MQTT) logFailure(token mqtt.Token, topic string) {
+	if !token.WaitTimeout(mqttTimeout) {
+		level.Warn(m.logger).Log("msg", "timed out waiting for MQTT broker", "topic", topic)
+	} else if err := token.Error(); err != nil {
+		level.Warn(m.logger).Log("msg", "MQTT request failed", "topic", topic, "err", err)
+	}
+}
+
+func (m *MQTT) topic(name string) string {
+	return m.cfg.Topic + "/" + name
+}
+
+// haEntity is a Home Assistant MQTT discovery payload
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic,omitempty"`
+	ValueTemplate     string   `json:"value_template,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	CommandTopic      string   `json:"command_topic,omitempty"`
+	PayloadPress      string   `json:"payload_press,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Device            haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+type discoveryMessage struct {
+	topic   string
+	payload string
+}
+
+var haInvalidID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// discovery returns the Home Assistant discovery payloads for the published topics
+func (m *MQTT) discovery() []discoveryMessage {
+	node := haInvalidID.ReplaceAllString(m.cfg.ClientID, "_")
+	device := haDevice{
+		Identifiers:  []string{node},
+		Name:         m.cfg.ClientID,
+		Manufacturer: "Zyxel",
+		Model:        "AMG1302-T11C",
+	}
+
+	entities := []struct {
+		component string
+		object    string
+		entity    haEntity
+	}{
+		{"binary_sensor", "connection", haEntity{Name: "Connection", StateTopic: m.topic("state"), DeviceClass: "connectivity",
+			// Suspect connections have not been declared down yet
+			ValueTemplate: "{{ 'ON' if value in ('up', 'suspect') else 'OFF' }}"}},
+		{"sensor", "state", haEntity{Name: "Connection state", StateTopic: m.topic("state"), Icon: "mdi:wan"}},
+		{"binary_sensor", "link", haEntity{Name: "Link", StateTopic: m.topic("link"), DeviceClass: "connectivity", PayloadOn: "up", PayloadOff: "down"}},
+		{"sensor", "wan_ip", haEntity{Name: "WAN IP", StateTopic: m.topic("wan_ip"), Icon: "mdi:ip-network"}},
+		{"sensor", "latency", haEntity{Name: "Latency", StateTopic: m.topic("latency"), Unit: "ms", StateClass: "measurement", Icon: "mdi:timer-outline"}},
+		{"sensor", "loss", haEntity{Name: "Packet loss", StateTopic: m.topic("loss"), Unit: "%", StateClass: "measurement", Icon: "mdi:lan-disconnect"}},
+		{"sensor", "resets", haEntity{Name: "Resets", StateTopic: m.topic("resets"), StateClass: "total_increasing", Icon: "mdi:restart"}},
+		{"sensor", "resets_24h", haEntity{Name: "Resets in 24 hours", StateTopic: m.topic("resets_24h"), StateClass: "measurement", Icon: "mdi:restart"}},
+		{"button", "reconnect", haEntity{Name: "Reconnect", CommandTopic: m.topic("command"), PayloadPress: mqttCommandReconnect, Icon: "mdi:refresh"}},
+	}
+
+	msgs := make([]discoveryMessage, 0, len(entities))
+	for _, e := range entities {
+		e.entity.UniqueID = node + "_" + e.object
+		e.entity.AvailabilityTopic = m.topic("availability")
+		e.entity.Device = device
+		payload, _ := json.Marshal(e.entity)
+		msgs = append(msgs, discoveryMessage{
+			topic:   fmt.Sprintf("%s/%s/%s/%s/config", m.cfg.DiscoveryPrefix, e.component, node, e.object),
+			payload: string(payload),
+		})
+	}
+	return msgs
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	stdnet "net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type mqttMessage struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+// recordingMQTT returns an MQTT reporter that records its messages instead of connecting to a broker
+func recordingMQTT(cfg MQTTConfig) (*MQTT, *[]mqttMessage) {
+	var msgs []mqttMessage
+	m := newMQTT(log.NewNopLogger(), cfg)
+	m.publisher = func(topic string, retained bool, payload string) {
+		msgs = append(msgs, mqttMessage{topic, retained, payload})
+	}
+	return m, &msgs
+}
+
+func TestMQTTReport(t *testing.T) {
+	m, msgs := recordingMQTT(MQTTConfig{Topic: "home/wan"})
+	m.Report(Status{State: "up", LinkUp: true, WANIP: stdnet.ParseIP("203.0.113.7"), Latency: 12340 * time.Microsecond, Loss: 25, Resets: 3, ResetsDay: 1})
+	assert.Equal(t, []mqttMessage{
+		{"home/wan/state", true, "up"},
+		{"home/wan/link", true, "up"},
+		{"home/wan/wan_ip", true, "203.0.113.7"},
+		{"home/wan/latency", true, "12.3"},
+		{"home/wan/loss", true, "25.0"},
+		{"home/wan/resets", true, "3"},
+		{"home/wan/resets_24h", true, "1"},
+	}, *msgs)
+
+	*msgs = nil
+	m.Report(Status{State: "down", LinkUp: true, Loss: 100, Resets: 3, ResetsDay: 1})
+	assert.Equal(t, []mqttMessage{
+		{"home/wan/state", true, "down"},
+		{"home/wan/wan_ip", true, "None"},
+		{"home/wan/latency", true, "None"},
+		{"home/wan/loss", true, "100.0"},
+	}, *msgs, "Only changed values should be published")
+
+	*msgs = nil
+	m.connected()
+	assert.Equal(t, mqttMessage{"home/wan/availability", true, "online"}, (*msgs)[0])
+	assert.Len(t, *msgs, 8, "The last state should be published again on connecting")
+
+	*msgs = nil
+	m.Notify(Event{Kind: EventConnectionDown, Time: time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), Message: "connection is down"})
+	assert.Equal(t, []mqttMessage{
+		{"home/wan/event", false, `{"kind":"connection_down","time":"2020-03-01T12:00:00Z","message":"connection is down","details":null}`},
+	}, *msgs, "Events should be published without being retained")
+}
+
+func TestMQTTCommand(t *testing.T) {
+	m, _ := recordingMQTT(MQTTConfig{Topic: "home/wan"})
+	m.command("flush")
+	m.command(" Reconnect\n")
+	m.command("reconnect")
+
+	select {
+	case source := <-m.Reconnects():
+		assert.Equal(t, "mqtt", source)
+	default:
+		t.Fatal("A reconnect should be requested")
+	}
+	select {
+	case <-m.Reconnects():
+		t.Fatal("A reconnect that is already pending should not be requested twice")
+	default:
+	}
+}
+
+func TestMQTTDiscovery(t *testing.T) {
+	m, msgs := recordingMQTT(MQTTConfig{Topic: "t11c-reset", ClientID: "t11c reset", DiscoveryPrefix: "homeassistant"})
+	m.connected()
+
+	configs := make(map[string]map[string]interface{})
+	for _, msg := range *msgs {
+		var entity map[string]interface{}
+		if json.Unmarshal([]byte(msg.payload), &entity) == nil {
+			assert.True(t, msg.retained, "Discovery payloads should be retained")
+			configs[msg.topic] = entity
+		}
+	}
+	assert.Len(t, configs, 9)
+
+	button := configs["homeassistant/button/t11c_reset/reconnect/config"]
+	if assert.NotNil(t, button) {
+		assert.Equal(t, "t11c-reset/command", button["command_topic"])
+		assert.Equal(t, "reconnect", button["payload_press"])
+		assert.Equal(t, "t11c_reset_reconnect", button["unique_id"])
+		assert.Equal(t, "t11c-reset/availability", button["availability_topic"])
+		assert.Equal(t, []interface{}{"t11c_reset"}, button["device"].(map[string]interface{})["identifiers"])
+	}
+	latency := configs["homeassistant/sensor/t11c_reset/latency/config"]
+	if assert.NotNil(t, latency) {
+		assert.Equal(t, "t11c-reset/latency", latency["state_topic"])
+		assert.Equal(t, "ms", latency["unit_of_measurement"])
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const queueCloseTimeout = 10 * time.Second // How long queued notifications may take to deliver when watch stops
+
+// QueueConfig configures how a notifier queues and retries events, so that events emitted while the connection is
+// down are delivered once it is back up
+type QueueConfig struct {
+	Retry  RetryPolicy   // How failed deliveries are retried
+	MaxAge time.Duration // How old an event may be before it is dropped rather than retried, or 0 to retry indefinitely
+	Size   int           // The number of events that may wait for delivery
+}
+
+// deliveryQueue delivers events in order in the background, retrying each batch until it is sent
+type deliveryQueue struct {
+	logger   log.Logger
+	cfg      QueueConfig
+	maxBatch int // The maximum number of waiting events delivered together
+	send     func(ctx context.Context, events []Event) error
+	events   chan Event
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newDeliveryQueue(logger log.Logger, cfg QueueConfig, maxBatch int, send func(context.Context, []Event) error) *deliveryQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &deliveryQueue{
+		logger:   logger,
+		cfg:      cfg,
+		maxBatch: maxBatch,
+		send:     send,
+		events:   make(chan Event, cfg.Size),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// permanentError is returned by a send function for a failure that retrying cannot fix, such as a request the
+// receiver rejects, so the batch is dropped rather than retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// push queues an event without blocking, dropping it if the queue is full
+func (q *deliveryQueue) push(ev Event) {
+	select {
+	case q.events <- ev:
+	default:
+		level.Warn(q.logger).Log("msg", "notification queue is full, dropping event", "event", ev.Kind)
+	}
+}
+
+// close stops accepting events, and waits a short time for the queue to be delivered
+func (q *deliveryQueue) close() {
+	close(q.events)
+	select {
+	case <-q.done:
+	case <-time.After(queueCloseTimeout):
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+}
+
+func (q *deliveryQueue) run() {
+	defer close(q.done)
+	for ev := range q.events {
+		q.deliver([]Event{ev})
+	}
+}
+
+// fill adds any waiting events to a batch, up to maxBatch
+func (q *deliveryQueue) fill(batch []Event) []Event {
+	for len(batch) < q.maxBatch {
+		select {
+		case ev, ok := <-q.events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, ev)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// deliver sends a batch of events, retrying until it succeeds, fails permanently, every event in it is too old, or the
+// queue is closed.
+// Events queued while the batch is being retried are added to it.
+func (q *deliveryQueue) deliver(batch []Event) {
+	for attempt := 1; ; attempt++ {
+		batch = q.fill(batch)
+		err := q.send(q.ctx, batch)
+		if err == nil {
+			level.Debug(q.logger).Log("msg", "notification sent", "event", batch[0].Kind, "events", len(batch), "attempt", attempt)
+			return
+		}
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			level.Warn(q.logger).Log("msg", "notification rejected, dropping it", "event", batch[0].Kind, "events", len(batch), "err", err)
+			return
+		}
+		if batch = q.expire(batch, attempt, err); len(batch) == 0 {
+			return
+		}
+
+		delay := q.cfg.Retry.delay(attempt)
+		level.Debug(q.logger).Log("msg", "notification failed, will retry", "event", batch[0].Kind, "attempt", attempt, "delay", delay, "err", err)
+		if !sleepContext(q.ctx, delay) {
+			level.Warn(q.logger).Log("msg", "notifier closed before notification could be sent", "event", batch[0].Kind, "events", len(batch), "err", err)
+			return
+		}
+	}
+}
+
+// expire drops the events in a batch that are older than MaxAge, keeping newer events to be retried
+func (q *deliveryQueue) expire(batch []Event, attempt int, err error) []Event {
+	if q.cfg.MaxAge <= 0 {
+		return batch
+	}
+
+	fresh := batch[:0]
+	var dropped []string
+	for _, ev := range batch {
+		if time.Since(ev.Time) > q.cfg.MaxAge {
+			dropped = append(dropped, string(ev.Kind))
+			continue
+		}
+		fresh = append(fresh, ev)
+	}
+	if len(dropped) > 0 {
+		level.Warn(q.logger).Log("msg", "dropping notifications that could not be sent", "events", strings.Join(dropped, ","), "attempt", attempt, "err", err)
+	}
+	return fresh
+}
+
+func wantsEvent(events []EventKind, kind EventKind) bool {
+	for _, e := range events {
+		if e == kind || e == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryQueueExpiry(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]EventKind
+	q := newDeliveryQueue(log.NewNopLogger(), QueueConfig{
+		Retry:  RetryPolicy{Backoff: time.Millisecond},
+		MaxAge: time.Minute,
+		Size:   10,
+	}, 10, func(ctx context.Context, events []Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var kinds []EventKind
+		for _, ev := range events {
+			kinds = append(kinds, ev.Kind)
+		}
+		sent = append(sent, kinds)
+		if len(sent) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	defer q.close()
+
+	// A batch mixing stale and fresh events should only drop the stale ones after a failed send
+	now := time.Now()
+	q.deliver([]Event{
+		{Kind: EventConnectionDown, Time: now.Add(-time.Hour)},
+		{Kind: EventConnectionUp, Time: now},
+	})
+	mu.Lock()
+	assert.Equal(t, [][]EventKind{{EventConnectionDown, EventConnectionUp}, {EventConnectionUp}}, sent, "The fresh event should be retried without the stale one")
+	mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how failed modem resets are retried
+type RetryPolicy struct {
+	MaxAttempts int           // The number of resets to attempt before giving up, or 0 to retry indefinitely
+	Backoff     time.Duration // The delay after the first failed attempt, doubled after each further failure
+	MaxBackoff  time.Duration // The maximum delay between attempts, or 0 for DefaultMaxBackoff
+}
+
+// DefaultMaxBackoff caps the delay between attempts of a policy without a MaxBackoff
+const DefaultMaxBackoff = time.Hour
+
+// delay returns the time to wait after the given number of failed attempts. The delay is randomised between half and
+// all of the exponential backoff, so that many instances do not retry in lockstep.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	backoff := p.Backoff
+	// Stop doubling at the cap, which also stops the duration overflowing after many attempts
+	for i := 1; i < attempt && backoff < maxBackoff && backoff <= math.MaxInt64/2; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// sleepContext waits for d, returning false if the context was cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
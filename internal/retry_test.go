@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for i := 0; i < 20; i++ {
+		d := p.delay(1)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, "The first delay should be jittered below the initial backoff, got %s", d)
+
+		d = p.delay(3)
+		assert.True(t, d >= 2*time.Second && d <= 4*time.Second, "The delay should double after each attempt, got %s", d)
+
+		d = p.delay(100)
+		assert.True(t, d >= 2500*time.Millisecond && d <= 5*time.Second, "The delay should be capped at the maximum, got %s", d)
+	}
+
+	assert.Zero(t, RetryPolicy{}.delay(1), "No backoff should retry immediately")
+
+	// Without a maximum, the backoff must neither overflow nor grow without bound over an unlimited number of attempts
+	uncapped := RetryPolicy{Backoff: 30 * time.Second}
+	for _, attempt := range []int{30, 40, 64, 70, 1000, math.MaxInt32} {
+		d := uncapped.delay(attempt)
+		assert.True(t, d >= DefaultMaxBackoff/2 && d <= DefaultMaxBackoff, "Attempt %d should be capped at the default maximum, got %s", attempt, d)
+	}
+	huge := RetryPolicy{Backoff: time.Duration(math.MaxInt64 / 3), MaxBackoff: time.Duration(math.MaxInt64)}
+	assert.True(t, huge.delay(100) > 0, "The backoff should not overflow when the maximum is near the limit")
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.True(t, sleepContext(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, sleepContext(ctx, time.Hour), "A cancelled context should end the sleep")
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const commandTimeout = 5 * time.Minute // How long an external command may run for
+
+// RouterHealthCheck configures the probe of the router's web interface, which can stop responding when the router
+// runs out of memory
+type RouterHealthCheck struct {
+	Timeout  time.Duration // How long the web interface may take to respond before the probe fails
+	Failures int           // The number of consecutive failed probes before the router is unresponsive, or 0 to disable
+	Action   []string      // A command run when the router becomes unresponsive, e.g. to power cycle it
+}
+
+// checkRouter probes the router's web interface, emitting an event when it becomes unresponsive or recovers, and
+// returns false while it is unresponsive
+func (w *watcher) checkRouter(ctx context.Context) bool {
+	if w.cfg.Router.Failures == 0 {
+		return true
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, w.cfg.Router.Timeout)
+	defer cancel()
+	rtt, err := w.conn.Reachable(probeCtx)
+	if ctx.Err() != nil {
+		return !w.routerUnresponsive
+	}
+
+	if err == nil {
+		w.routerFailures = 0
+		w.routerRtt = rtt
+		level.Debug(w.logger).Log("msg", "router responded", "response_time", rtt)
+		if w.routerUnresponsive {
+			w.routerUnresponsive = false
+			w.emit(EventRouterResponsive, "router web interface is responding again, resuming remediation", "response_time", rtt.String())
+		}
+		return true
+	}
+
+	w.routerFailures++
+	level.Warn(w.logger).Log("msg", "router web interface did not respond", "failures", w.routerFailures, "err", err)
+	if w.routerFailures < w.cfg.Router.Failures {
+		return !w.routerUnresponsive
+	}
+
+	if !w.routerUnresponsive {
+		w.routerUnresponsive = true
+		w.emit(EventRouterUnresponsive, "router web interface is unresponsive, pausing remediation", "failures", strconv.Itoa(w.routerFailures), "err", err.Error())
+		w.runRouterAction(ctx)
+	}
+	return false
+}
+
+// runRouterAction runs the configured command for an unresponsive router, if any
+func (w *watcher) runRouterAction(ctx context.Context) {
+	if len(w.cfg.Router.Action) == 0 {
+		return
+	}
+	if err := w.runCommand(ctx, "unresponsive router action", w.cfg.Router.Action); err != nil {
+		level.Error(w.logger).Log("msg", "unresponsive router action failed", "err", err)
+	}
+}
+
+// runCommand runs an external command, logging its output. With --no-action, the command is only logged.
+func (w *watcher) runCommand(ctx context.Context, purpose string, argv []string) error {
+	if w.conn.DryRun {
+		level.Info(w.logger).Log("msg", "would run "+purpose, "command", strings.Join(argv, " "))
+		return nil
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	level.Info(w.logger).Log("msg", "running "+purpose, "command", argv[0])
+	out, err := exec.CommandContext(cmdCtx, argv[0], argv[1:]...).CombinedOutput()
+	if err != nil {
+		level.Warn(w.logger).Log("msg", purpose+" failed", "output", string(out))
+		return err
+	}
+	level.Info(w.logger).Log("msg", purpose+" complete", "output", string(out))
+	return nil
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRouter(t *testing.T) {
+	ctx := context.Background()
+	var slow int32
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&slow) != 0 {
+			time.Sleep(2 * time.Second)
+		}
+	}))
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{})
+	w.cfg.Router = RouterHealthCheck{Timeout: time.Second, Failures: 2}
+
+	assert.True(t, w.checkRouter(ctx), "A responding router should be healthy")
+	assert.NotZero(t, w.routerRtt, "The response time should be recorded")
+
+	atomic.StoreInt32(&slow, 1)
+	assert.True(t, w.checkRouter(ctx), "A single slow response should not make the router unresponsive")
+	assert.False(t, w.checkRouter(ctx), "Consecutive slow responses should make the router unresponsive")
+	assert.True(t, w.routerUnresponsive)
+
+	atomic.StoreInt32(&slow, 0)
+	assert.True(t, w.checkRouter(ctx), "A single response should end the unresponsive state")
+	assert.False(t, w.routerUnresponsive)
+	assert.Zero(t, w.routerFailures)
+}
+
+func TestRunCommandDryRun(t *testing.T) {
+	router := httptest.NewServer(http.NotFoundHandler())
+	defer router.Close()
+	w := testWatcher(t, router, WatchConfig{})
+
+	w.conn.DryRun = true
+	assert.NoError(t, w.runCommand(context.Background(), "power cycle command", []string{"/nonexistent/power-cycle"}), "Commands should not be run with --no-action")
+
+	w.conn.DryRun = false
+	assert.Error(t, w.runCommand(context.Background(), "power cycle command", []string{"/nonexistent/power-cycle"}))
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next time a scheduled reconnect is due after the given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseSchedule parses a standard five field cron expression, optionally prefixed with a timezone as in
+// "CRON_TZ=Europe/London 0 4 * * *"
+func ParseSchedule(expr string) (Schedule, error) {
+	return cron.ParseStandard(expr)
+}
+
+// ScheduledReconnect configures proactive redials, e.g. a nightly reconnect to re-sync the line
+type ScheduledReconnect struct {
+	Schedule   Schedule      // When reconnects are due, or nil to disable them
+	MinUptime  time.Duration // How long the connection must have been up before a reconnect
+	IdleKbps   float64       // The WAN traffic rate, in kbit/s, at or above which a reconnect waits, or 0 to ignore traffic
+	IdleSample time.Duration // The minimum time over which the WAN traffic rate is measured, across checks
+	Window     time.Duration // How long a due reconnect waits for the conditions to be met before it is skipped
+}
+
+// checkSchedule redials the modem if a scheduled reconnect is due and its conditions are met, returning true if a
+// reconnect was attempted
+func (w *watcher) checkSchedule(ctx context.Context, now time.Time) bool {
+	sched := w.cfg.Scheduled.Schedule
+	if sched == nil {
+		return false
+	}
+	if w.nextScheduled.IsZero() {
+		w.nextScheduled = sched.Next(now)
+	}
+	if now.Before(w.nextScheduled) {
+		return false
+	}
+
+	if reason := w.scheduleBlocked(ctx, now); reason != "" {
+		if now.Sub(w.nextScheduled) >= w.cfg.Scheduled.Window {
+			w.emit(EventScheduledSkipped, "scheduled reconnect skipped", "due", w.nextScheduled.UTC().Format(time.RFC3339), "reason", reason)
+			w.nextScheduled = sched.Next(now)
+			w.trafficSampled = time.Time{}
+		} else {
+			level.Debug(w.logger).Log("msg", "scheduled reconnect waiting", "due", w.nextScheduled, "reason", reason)
+		}
+		return false
+	}
+
+	w.nextScheduled = sched.Next(now)
+	w.trafficSampled = time.Time{}
+	if !w.checkBudget() {
+		return false
+	}
+	w.recordReset(now)
+
+	w.emit(EventResetStarted, "taking scheduled remediation action", "action", string(ActionRedial))
+	if err := w.runStep(ctx, EscalationStep{Action: ActionRedial}); err != nil {
+		// The next check will find the connection down and remediate as usual
+		w.emit(EventScheduledReconnect, "scheduled reconnect failed", "outcome", "failed", "err", err.Error())
+		return true
+	}
+	w.emit(EventScheduledReconnect, "scheduled reconnect complete", "outcome", "restored")
+	w.afterReset()
+	return true
+}
+
+// requestedReconnect redials the modem on request, e.g. from the MQTT command topic, unless it is in maintenance or the
+// reset budget is exhausted
+func (w *watcher) requestedReconnect(ctx context.Context, source string) {
+	if w.checkMaintenance(time.Now()) {
+		w.emit(EventRequestedReconnect, "requested reconnect refused during maintenance", "source", source, "outcome", "refused")
+		return
+	}
+	if !w.checkBudget() {
+		w.emit(EventRequestedReconnect, "requested reconnect refused, reset budget exhausted", "source", source, "outcome", "refused")
+		return
+	}
+	w.recordReset(time.Now())
+
+	w.emit(EventResetStarted, "taking requested remediation action", "action", string(ActionRedial), "source", source)
+	if err := w.runStep(ctx, EscalationStep{Action: ActionRedial}); err != nil {
+		w.emit(EventRequestedReconnect, "requested reconnect failed", "source", source, "outcome", "failed", "err", err.Error())
+		return
+	}
+	w.emit(EventRequestedReconnect, "requested reconnect complete", "source", source, "outcome", "restored")
+	w.afterReset()
+}
+
+// scheduleBlocked returns the reason a due reconnect cannot run yet, or an empty string if it can
+func (w *watcher) scheduleBlocked(ctx context.Context, now time.Time) string {
+	if w.maintenance {
+		return "maintenance"
+	}
+	if uptime := now.Sub(w.upSince); w.upSince.IsZero() || uptime < w.cfg.Scheduled.MinUptime {
+		return fmt.Sprintf("connection has only been up for %s", uptime.Round(time.Second))
+	}
+	if w.cfg.Scheduled.IdleKbps > 0 {
+		kbps, measured, err := w.trafficRate(ctx, now)
+		if err != nil {
+			return fmt.Sprintf("failed to measure WAN traffic: %s", err)
+		}
+		if !measured {
+			return "measuring WAN traffic"
+		}
+		if kbps >= w.cfg.Scheduled.IdleKbps {
+			return fmt.Sprintf("WAN traffic is %.1f kbit/s", kbps)
+		}
+	}
+	return ""
+}
+
+// trafficRate measures the combined WAN traffic rate, in kbit/s, from the change in the router's counters since a
+// sample taken on an earlier check, so that the watch loop is not held up while traffic is measured. It returns false
+// until the sample is at least IdleSample old. The counters are experimental, see t11c.Connection.TrafficCounters.
+func (w *watcher) trafficRate(ctx context.Context, now time.Time) (float64, bool, error) {
+	if err := w.ensureSession(ctx); err != nil {
+		return 0, false, err
+	}
+	counters, err := w.conn.TrafficCounters(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	before, elapsed := w.trafficSample, now.Sub(w.trafficSampled)
+	if w.trafficSampled.IsZero() || elapsed <= 0 {
+		w.trafficSample, w.trafficSampled = counters, now
+		return 0, false, nil
+	}
+	if elapsed < w.cfg.Scheduled.IdleSample {
+		return 0, false, nil
+	}
+	w.trafficSample, w.trafficSampled = counters, now
+
+	// The counters start again from zero when the router restarts
+	if counters.RxBytes < before.RxBytes || counters.TxBytes < before.TxBytes {
+		return 0, false, errors.New("traffic counters went backwards, the router may have restarted")
+	}
+	bytes := (counters.RxBytes - before.RxBytes) + (counters.TxBytes - before.TxBytes)
+	return float64(bytes) * 8 / 1000 / elapsed.Seconds(), true, nil
+}
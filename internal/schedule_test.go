@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const wanStatsTemplate = `<html><body><table>
+<tr><td id="WanStats_RxBytes">%d</td></tr>
+<tr><td id="WanStats_TxBytes">%d</td></tr>
+</table></body></html>`
+
+func TestParseSchedule(t *testing.T) {
+	sched, err := ParseSchedule("CRON_TZ=UTC 30 4 * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 6, 2, 4, 30, 0, 0, time.UTC), sched.Next(time.Date(2020, 6, 1, 5, 0, 0, 0, time.UTC)).UTC())
+
+	_, err = ParseSchedule("every night")
+	assert.Error(t, err)
+}
+
+func TestCheckScheduleSkipped(t *testing.T) {
+	ctx := context.Background()
+	var rx uint64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/pages/statistics/wanstats.cgi", func(w http.ResponseWriter, r *http.Request) {
+		rx += 125000
+		fmt.Fprintf(w, wanStatsTemplate, rx, 0)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router := httptest.NewServer(mux)
+	defer router.Close()
+
+	sched, err := ParseSchedule("CRON_TZ=UTC 0 4 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := testWatcher(t, router, WatchConfig{})
+	w.cfg.Scheduled = ScheduledReconnect{
+		Schedule:   sched,
+		MinUptime:  time.Hour,
+		IdleKbps:   100,
+		IdleSample: time.Second,
+		Window:     time.Hour,
+	}
+
+	now := time.Date(2020, 6, 1, 3, 0, 0, 0, time.UTC)
+	assert.False(t, w.checkSchedule(ctx, now))
+	assert.Equal(t, time.Date(2020, 6, 1, 4, 0, 0, 0, time.UTC), w.nextScheduled.UTC())
+
+	now = now.Add(time.Hour)
+	w.upSince = now.Add(-time.Minute)
+	assert.Contains(t, w.scheduleBlocked(ctx, now), "only been up", "A connection that has just come up should not be reconnected")
+	assert.False(t, w.checkSchedule(ctx, now))
+	assert.Equal(t, now, w.nextScheduled.UTC(), "A blocked reconnect should wait within its window")
+
+	w.upSince = now.Add(-2 * time.Hour)
+	assert.Equal(t, "measuring WAN traffic", w.scheduleBlocked(ctx, now), "Traffic should be sampled across checks")
+	assert.Equal(t, "measuring WAN traffic", w.scheduleBlocked(ctx, now.Add(time.Millisecond)), "A sample should span IdleSample")
+	assert.Contains(t, w.scheduleBlocked(ctx, now.Add(time.Second)), "WAN traffic is", "A busy connection should not be reconnected")
+
+	rx = 0
+	assert.Contains(t, w.scheduleBlocked(ctx, now.Add(2*time.Second)), "went backwards", "Counters that reset should not be treated as idle")
+
+	now = now.Add(time.Hour)
+	rx += 1 << 40
+	assert.False(t, w.checkSchedule(ctx, now))
+	assert.Equal(t, time.Date(2020, 6, 2, 4, 0, 0, 0, time.UTC), w.nextScheduled.UTC(), "A reconnect blocked for its whole window should be skipped")
+}
+
+func TestRequestedReconnect(t *testing.T) {
+	ctx := context.Background()
+	var dials []string
+	router := fakeRouter(t, func(flag string) {
+		dials = append(dials, flag)
+	})
+	defer router.Close()
+
+	reporter := &recordingReporter{}
+	w := testWatcher(t, router, WatchConfig{
+		Budget:    ResetBudget{PerHour: 1},
+		Notifiers: []Notifier{reporter},
+	})
+
+	// The unresolvable target fails the wait for the connection to recover
+	w.requestedReconnect(ctx, "test")
+	assert.Equal(t, []string{"2", "1"}, dials, "A requested reconnect should redial the modem")
+	assert.Equal(t, []EventKind{EventResetStarted, EventRequestedReconnect}, reporter.events)
+	assert.Equal(t, 1, w.totalResets, "A requested reconnect should count as a reset")
+
+	w.requestedReconnect(ctx, "test")
+	assert.Len(t, dials, 2, "A requested reconnect should be refused once the budget is exhausted")
+	assert.Equal(t, []EventKind{EventResetStarted, EventRequestedReconnect, EventResetSuppressed, EventRequestedReconnect}, reporter.events)
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// SMTPSecurity selects how the connection to the mail server is secured
+type SMTPSecurity string
+
+const (
+	SMTPStartTLS SMTPSecurity = "starttls" // Connect in plain text, and require the server to support STARTTLS
+	SMTPTLS      SMTPSecurity = "tls"      // Connect with TLS from the start, usually on port 465
+	SMTPNone     SMTPSecurity = "none"     // Never use TLS
+)
+
+const (
+	smtpTimeout  = 30 * time.Second // How long a single delivery may take
+	smtpMaxBatch = 50               // The maximum number of queued events summarised in one message
+)
+
+// ParseSMTPSecurity checks the name of an SMTPSecurity mode
+func ParseSMTPSecurity(s string) (SMTPSecurity, error) {
+	switch sec := SMTPSecurity(strings.ToLower(s)); sec {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+		return sec, nil
+	}
+	return "", fmt.Errorf("unknown SMTP security %q, expected starttls, tls or none", s)
+}
+
+// SMTPConfig configures an email notifier
+type SMTPConfig struct {
+	Server    string // host:port of the mail server
+	Security  SMTPSecurity
+	TLSConfig *tls.Config // Overrides the TLS settings, or nil to verify the server's certificate against its host name
+	Username  string      // The user to authenticate as with AUTH PLAIN, or "" to send without authenticating
+	Password  string
+	From      string
+	To        []string
+	Events    []EventKind // The events to send, or nil for DefaultNotifyEvents
+	Queue     QueueConfig
+}
+
+// SMTPNotifier is a Notifier that emails events. Events that are queued while the connection is down are summarised
+// in a single message once it is back up.
+type SMTPNotifier struct {
+	cfg   SMTPConfig
+	host  string
+	queue *deliveryQueue
+}
+
+// NewSMTPNotifier creates an SMTPNotifier and starts delivering its queue in the background
+func NewSMTPNotifier(logger log.Logger, cfg SMTPConfig) (*SMTPNotifier, error) {
+	host, _, err := stdnet.SplitHostPort(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP server %q: %w", cfg.Server, err)
+	}
+	if cfg.From == "" {
+		return nil, errors.New("no sender address")
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	if cfg.Security == "" {
+		cfg.Security = SMTPStartTLS
+	}
+	// smtp.PlainAuth refuses to send a password unencrypted, except to the local machine
+	if cfg.Security == SMTPNone && cfg.Username != "" && host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		return nil, errors.New("a username cannot be used with an unencrypted connection to a remote mail server")
+	}
+	if cfg.Events == nil {
+		cfg.Events = DefaultNotifyEvents
+	}
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{}
+	}
+	if cfg.TLSConfig.ServerName == "" {
+		cfg.TLSConfig = cfg.TLSConfig.Clone()
+		cfg.TLSConfig.ServerName = host
+	}
+
+	sn := &SMTPNotifier{cfg: cfg, host: host}
+	sn.queue = newDeliveryQueue(log.With(logger, "smtp", cfg.Server), cfg.Queue, smtpMaxBatch, sn.send)
+	return sn, nil
+}
+
+func (sn *SMTPNotifier) Notify(ev Event) {
+	if wantsEvent(sn.cfg.Events, ev.Kind) {
+		sn.queue.push(ev)
+	}
+}
+
+func (sn *SMTPNotifier) Close() {
+	sn.queue.close()
+}
+
+func (sn *SMTPNotifier) dial(ctx context.Context) (stdnet.Conn, error) {
+	d := stdnet.Dialer{Timeout: smtpTimeout}
+	if sn.cfg.Security == SMTPTLS {
+		td := tls.Dialer{NetDialer: &d, Config: sn.cfg.TLSConfig}
+		return td.DialContext(ctx, "tcp", sn.cfg.Server)
+	}
+	return d.DialContext(ctx, "tcp", sn.cfg.Server)
+}
+
+func (sn *SMTPNotifier) send(ctx context.Context, events []Event) error {
+	conn, err := sn.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	// Abort the conversation if the notifier is closed
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, sn.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if sn.cfg.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(sn.cfg.TLSConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if sn.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", sn.cfg.Username, sn.cfg.Password, sn.host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := c.Mail(sn.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range sn.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(sn.message(events, time.Now())); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message formats events as an email, with the latest event as the subject
+func (sn *SMTPNotifier) message(events []Event, now time.Time) []byte {
+	last := events[len(events)-1]
+	subject := fmt.Sprintf("t11c-reset: %s", last.Message)
+	if outage, ok := last.Details["outage"]; ok {
+		subject += fmt.Sprintf(" (outage %s)", outage)
+	}
+	if len(events) > 1 {
+		subject += fmt.Sprintf(" [%d events]", len(events))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", sn.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(sn.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+
+	for _, ev := range events {
+		fmt.Fprintf(&buf, "%s  %s: %s\r\n", ev.Time.Format("2006-01-02 15:04:05 MST"), ev.Kind, ev.Message)
+		keys := make([]string, 0, len(ev.Details))
+		for k := range ev.Details {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "    %s: %s\r\n", k, ev.Details[k])
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer accepts mail on a local port, speaking just enough SMTP for net/smtp
+type fakeSMTPServer struct {
+	listener stdnet.Listener
+	tls      *tls.Config // Offers STARTTLS if set
+
+	mu         sync.Mutex
+	rejections int // The number of connections to turn away before accepting mail
+	auth       []string
+	recipients []string
+	messages   []string
+}
+
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config, rejections int) *fakeSMTPServer {
+	l, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: l, tls: tlsConfig, rejections: rejections}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// received returns the credentials, recipients and messages received so far
+func (s *fakeSMTPServer) received() (auth, recipients, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.auth...), append([]string(nil), s.recipients...), append([]string(nil), s.messages...)
+}
+
+func (s *fakeSMTPServer) serve(conn stdnet.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+
+	s.mu.Lock()
+	reject := s.rejections > 0
+	if reject {
+		s.rejections--
+	}
+	s.mu.Unlock()
+	if reject {
+		tp.PrintfLine("421 try again later")
+		return
+	}
+
+	tp.PrintfLine("220 fake ESMTP")
+	secure := false
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			if s.tls != nil && !secure {
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250-STARTTLS")
+			} else {
+				tp.PrintfLine("250-fake")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			tp = textproto.NewConn(tlsConn)
+			secure = true
+		case "AUTH":
+			fields := strings.Fields(line)
+			cred, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			s.mu.Lock()
+			s.auth = append(s.auth, string(cred))
+			s.mu.Unlock()
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			msg, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(msg))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	// Simulate the outage that the events describe by turning away the first connections
+	server := newFakeSMTPServer(t, nil, 2)
+	defer server.listener.Close()
+
+	sn, err := NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{
+		Server:   server.listener.Addr().String(),
+		Security: SMTPNone,
+		Username: "watch",
+		Password: "secret",
+		From:     "watch@example.com",
+		To:       []string{"a@example.com", "b@example.com"},
+		Queue:    QueueConfig{Retry: RetryPolicy{Backoff: 50 * time.Millisecond}, Size: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	sn.Notify(Event{Kind: EventConnectionDown, Time: start, Message: "connection is down", Details: map[string]string{}})
+	sn.Notify(Event{Kind: EventLinkUp, Time: start, Message: "not sent"})
+	sn.Notify(Event{Kind: EventResetStarted, Time: start.Add(time.Second), Message: "resetting connection", Details: map[string]string{"attempt": "1", "action": "redial"}})
+	sn.Notify(Event{Kind: EventConnectionUp, Time: start.Add(time.Minute), Message: "connection is up", Details: map[string]string{"outage": "1m0s"}})
+	sn.Close()
+
+	auth, recipients, messages := server.received()
+	assert.Equal(t, []string{"\x00watch\x00secret"}, auth, "Should authenticate with AUTH PLAIN")
+	assert.Equal(t, []string{"<a@example.com>", "<b@example.com>"}, recipients, "Should send to every recipient")
+	if assert.Len(t, messages, 1, "Events queued during the outage should be sent as one message") {
+		msg := messages[0]
+		assert.Contains(t, msg, "To: a@example.com, b@example.com\n")
+		assert.Contains(t, msg, "Subject: t11c-reset: connection is up (outage 1m0s) [3 events]\n")
+		assert.Contains(t, msg, "\n2020-03-01 12:00:00 UTC  connection_down: connection is down\n"+
+			"2020-03-01 12:00:01 UTC  reset_started: resetting connection\n"+
+			"    action: redial\n"+
+			"    attempt: 1\n"+
+			"2020-03-01 12:01:00 UTC  connection_up: connection is up\n"+
+			"    outage: 1m0s\n")
+		assert.NotContains(t, msg, "not sent", "Unwanted events should be skipped")
+	}
+}
+
+func TestSMTPNotifierStartTLS(t *testing.T) {
+	// Borrow the certificate of an httptest server, which the client of that server trusts
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	server := newFakeSMTPServer(t, https.TLS, 0)
+	defer server.listener.Close()
+
+	sn, err := NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{
+		Server:    server.listener.Addr().String(),
+		TLSConfig: https.Client().Transport.(*http.Transport).TLSClientConfig,
+		From:      "watch@example.com",
+		To:        []string{"a@example.com"},
+		Queue:     QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, MaxAge: time.Minute, Size: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn.Notify(Event{Kind: EventConnectionDown, Time: time.Now(), Message: "connection is down"})
+	sn.Close()
+	_, _, messages := server.received()
+	assert.Len(t, messages, 1, "Should send over STARTTLS")
+
+	// A server without STARTTLS must not be sent mail in plain text
+	plain := newFakeSMTPServer(t, nil, 0)
+	defer plain.listener.Close()
+	sn, err = NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{
+		Server: plain.listener.Addr().String(),
+		From:   "watch@example.com",
+		To:     []string{"a@example.com"},
+		Queue:  QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, MaxAge: time.Nanosecond, Size: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sn.Notify(Event{Kind: EventConnectionDown, Time: time.Now(), Message: "connection is down"})
+	sn.Close()
+	_, _, messages = plain.received()
+	assert.Empty(t, messages, "Should refuse to send without STARTTLS")
+}
+
+func TestNewSMTPNotifierValidation(t *testing.T) {
+	_, err := NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{Server: "mail.example.com", From: "a@example.com", To: []string{"b@example.com"}})
+	assert.Error(t, err, "Should require a port")
+	_, err = NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{Server: "mail.example.com:587", From: "a@example.com"})
+	assert.Error(t, err, "Should require recipients")
+	_, err = NewSMTPNotifier(log.NewNopLogger(), SMTPConfig{Server: "mail.example.com:25", Security: SMTPNone, Username: "watch", From: "a@example.com", To: []string{"b@example.com"}})
+	assert.Error(t, err, "Should refuse to authenticate over an unencrypted connection to a remote server")
+
+	sec, err := ParseSMTPSecurity("TLS")
+	assert.NoError(t, err)
+	assert.Equal(t, SMTPTLS, sec)
+	_, err = ParseSMTPSecurity("ssl3")
+	assert.Error(t, err)
+}
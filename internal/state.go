@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	stateFileName = "state.json"
+	stateVersion  = 1
+)
+
+// persistedState is the part of the watch state that survives a restart, so that budgets, cooldowns and the current
+// incident are not forgotten. Giving up on remediation is deliberately not persisted, so that restarting watch resumes it.
+type persistedState struct {
+	Version           int         `json:"version"`
+	State             string      `json:"state"`
+	Failures          int         `json:"consecutive_failures"`
+	Successes         int         `json:"consecutive_successes"`
+	DownSince         time.Time   `json:"down_since,omitempty"`
+	Attempts          int         `json:"remediation_attempts"`
+	LastReset         time.Time   `json:"last_reset,omitempty"`
+	TotalResets       int         `json:"total_resets"`
+	Resets            []time.Time `json:"recent_resets"`
+	LastDegradedReset time.Time   `json:"last_degraded_reset,omitempty"`
+	LastIPv6Reset     time.Time   `json:"last_ipv6_reset,omitempty"`
+	LinkInterface     string      `json:"link_interface,omitempty"`
+}
+
+func parseConnState(s string) connState {
+	for _, state := range []connState{stateUp, stateSuspect, stateDown, stateRecovering} {
+		if state.String() == s {
+			return state
+		}
+	}
+	return stateUp
+}
+
+func (w *watcher) statePath() string {
+	return filepath.Join(w.cfg.StateDir, stateFileName)
+}
+
+// loadState restores the state saved by a previous run, if any
+func (w *watcher) loadState() {
+	if w.cfg.StateDir == "" {
+		level.Warn(w.logger).Log("msg", "state persistence is disabled, budgets and the current outage will be forgotten on restart")
+		return
+	}
+
+	content, err := ioutil.ReadFile(w.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to read state file", "path", w.statePath(), "err", err)
+		return
+	}
+
+	var ps persistedState
+	if err := json.Unmarshal(content, &ps); err != nil || ps.Version != stateVersion {
+		level.Warn(w.logger).Log("msg", "ignoring invalid state file", "path", w.statePath(), "err", err)
+		return
+	}
+
+	w.state = parseConnState(ps.State)
+	w.failures = ps.Failures
+	w.successes = ps.Successes
+	w.downSince = ps.DownSince
+	w.attempts = ps.Attempts
+	w.lastReset = ps.LastReset
+	w.totalResets = ps.TotalResets
+	w.limiter.resets = ps.Resets
+	w.limiter.expire(time.Now())
+	w.lastDegradedReset = ps.LastDegradedReset
+	w.lastIPv6Reset = ps.LastIPv6Reset
+	w.linkInterface = ps.LinkInterface
+	w.savedState = content
+
+	level.Info(w.logger).Log("msg", "restored state from previous run", "state", w.state, "last_reset", ps.LastReset, "recent_resets", len(w.limiter.resets))
+}
+
+// saveState writes the current state if it has changed, replacing the state file atomically so that a crash cannot
+// leave it partially written
+func (w *watcher) saveState() {
+	if w.cfg.StateDir == "" {
+		return
+	}
+
+	content, err := json.MarshalIndent(persistedState{
+		Version:           stateVersion,
+		State:             w.state.String(),
+		Failures:          w.failures,
+		Successes:         w.successes,
+		DownSince:         w.downSince,
+		Attempts:          w.attempts,
+		LastReset:         w.lastReset,
+		TotalResets:       w.totalResets,
+		Resets:            w.limiter.resets,
+		LastDegradedReset: w.lastDegradedReset,
+		LastIPv6Reset:     w.lastIPv6Reset,
+		LinkInterface:     w.linkInterface,
+	}, "", "  ")
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to encode state", "err", err)
+		return
+	}
+	if bytes.Equal(content, w.savedState) {
+		return
+	}
+
+	if err := writeFileAtomic(w.statePath(), content); err != nil {
+		level.Error(w.logger).Log("msg", "failed to save state", "path", w.statePath(), "err", err)
+		return
+	}
+	w.savedState = content
+}
+
+// writeFileAtomic writes to a temporary file in the same directory, then renames it over path
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
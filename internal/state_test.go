@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t11c-reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := WatchConfig{Interval: 15, StateDir: filepath.Join(dir, "state"), Budget: ResetBudget{PerHour: 1}}
+	now := time.Now().Round(time.Second)
+
+	w := newWatcher(log.NewNopLogger(), nil, cfg)
+	w.observe(false, now)
+	w.attempts = 2
+	w.recordReset(now)
+	assert.FileExists(t, filepath.Join(cfg.StateDir, stateFileName), "Recording a reset should save the state")
+
+	// A restarted watcher should carry on with the same incident and budget
+	restarted := newWatcher(log.NewNopLogger(), nil, cfg)
+	restarted.loadState()
+	assert.Equal(t, stateDown, restarted.state)
+	assert.Equal(t, 1, restarted.failures)
+	assert.True(t, now.Equal(restarted.downSince))
+	assert.True(t, now.Equal(restarted.lastReset))
+	assert.Equal(t, 1, restarted.totalResets)
+	assert.Equal(t, 2, restarted.attempts, "Remediation should resume from the same escalation step")
+	wait, _ := restarted.limiter.allow(now)
+	assert.NotZero(t, wait, "The reset budget should survive a restart")
+
+	files, err := ioutil.ReadDir(cfg.StateDir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "No temporary files should be left behind")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(cfg.StateDir, stateFileName), []byte("{"), 0644))
+	corrupt := newWatcher(log.NewNopLogger(), nil, cfg)
+	corrupt.loadState()
+	assert.Equal(t, stateUp, corrupt.state, "An invalid state file should be ignored")
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"context"
+	stdnet "net"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const wanIPRefresh = 15 * time.Minute // How often the WAN IP is read from the router while the connection is up
+
+// Status is a snapshot of the watch state, given to each StatusReporter after every check
+type Status struct {
+	State     string        // The declared connection state: up, suspect, down or recovering
+	LinkUp    bool          // The local interface is known to have a link
+	WANIP     stdnet.IP     // The WAN address reported by the router, or nil if it is not known
+	Latency   time.Duration // The mean round trip time of the last check, or 0 if no target replied
+	Loss      float64       // The mean packet loss of the last check, as a percentage
+	Resets    int           // The total number of resets
+	ResetsDay int           // The number of resets in the last 24 hours
+}
+
+// StatusReporter is a Notifier that also publishes the watch state, e.g. to MQTT
+type StatusReporter interface {
+	Notifier
+	Report(s Status)
+}
+
+// report gives the current state to every StatusReporter
+func (w *watcher) report(ctx context.Context) {
+	var reporters []StatusReporter
+	for _, n := range w.cfg.Notifiers {
+		if r, ok := n.(StatusReporter); ok {
+			reporters = append(reporters, r)
+		}
+	}
+	if len(reporters) == 0 {
+		return
+	}
+
+	w.refreshWANIP(ctx)
+	now := time.Now()
+	latency, loss := w.lastResult.Average()
+	s := Status{
+		State:     w.state.String(),
+		LinkUp:    !w.linkDown && !w.linkUnknown,
+		WANIP:     w.wanIP,
+		Latency:   latency,
+		Loss:      loss,
+		Resets:    w.totalResets,
+		ResetsDay: len(w.limiter.since(now.Add(-24 * time.Hour))),
+	}
+	for _, r := range reporters {
+		r.Report(s)
+	}
+}
+
+// refreshWANIP reads the WAN IP from the router when the connection comes up, and periodically while it stays up
+func (w *watcher) refreshWANIP(ctx context.Context) {
+	if w.state == stateDown {
+		w.wanIP = nil
+		return
+	}
+	// Logging in to the router is avoided while it is struggling or being worked on
+	if w.state != stateUp || w.linkDown || w.linkUnknown || w.routerUnresponsive || w.maintenance {
+		return
+	}
+	if w.wanIP != nil && w.wanIPChecked.After(w.upSince) && time.Since(w.wanIPChecked) < wanIPRefresh {
+		return
+	}
+	w.wanIPChecked = time.Now()
+
+	if err := w.ensureSession(ctx); err != nil {
+		return
+	}
+	status, err := w.conn.WANStatus(ctx)
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to read WAN IP", "err", err)
+		return
+	}
+	w.wanIP = status.IP
+}
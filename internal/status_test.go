@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+)
+
+// recordingReporter records the events and states it is given
+type recordingReporter struct {
+	events   []EventKind
+	statuses []Status
+}
+
+func (r *recordingReporter) Notify(ev Event) { r.events = append(r.events, ev.Kind) }
+func (r *recordingReporter) Close()          {}
+func (r *recordingReporter) Report(s Status) { r.statuses = append(r.statuses, s) }
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	statusReads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/pages/statusview.cgi", func(w http.ResponseWriter, r *http.Request) {
+		statusReads++
+		fmt.Fprintf(w, statusViewTemplate, "203.0.113.7", "203.0.113.1")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router := httptest.NewServer(mux)
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{})
+	w.report(ctx)
+	assert.Zero(t, statusReads, "The router should not be asked for the WAN IP without a reporter")
+
+	reporter := &recordingReporter{}
+	w.cfg.Notifiers = []Notifier{reporter}
+	w.totalResets = 3
+	w.limiter.record(time.Now().Add(-time.Hour))
+	w.lastResult = net.CheckResult{Up: true, Results: []net.ProbeResult{
+		{Sent: 4, Recv: 3, Loss: 25, AvgRtt: 12 * time.Millisecond},
+	}}
+
+	w.report(ctx)
+	w.report(ctx)
+	assert.Equal(t, 1, statusReads, "The WAN IP should not be read again until it is due")
+	if assert.Len(t, reporter.statuses, 2) {
+		assert.Equal(t, Status{
+			State:     "up",
+			LinkUp:    true,
+			WANIP:     stdnet.ParseIP("203.0.113.7"),
+			Latency:   12 * time.Millisecond,
+			Loss:      25,
+			Resets:    3,
+			ResetsDay: 1,
+		}, reporter.statuses[0])
+	}
+
+	w.upSince = time.Now().Add(time.Second)
+	w.report(ctx)
+	assert.Equal(t, 2, statusReads, "The WAN IP should be read again after the connection comes up")
+
+	w.state = stateDown
+	w.report(ctx)
+	assert.Nil(t, reporter.statuses[3].WANIP, "The WAN IP should be unknown while the connection is down")
+	assert.Equal(t, "down", reporter.statuses[3].State)
+}
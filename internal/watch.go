@@ -2,7 +2,11 @@ package internal
 
 import (
 	"context"
+	"fmt"
+	stdnet "net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -12,10 +16,140 @@ import (
 	"github.com/ks07/t11c-reset/pkg/t11c"
 )
 
-func WatchReset(ctx context.Context, logger log.Logger, conn *t11c.Connection, interval uint, privileged bool, remoteHosts []string) {
-	level.Info(logger).Log("interval", interval, "remote_hosts", strings.Join(remoteHosts, ","), "msg", "starting monitoring")
+// WatchConfig holds the settings for the watch loop
+type WatchConfig struct {
+	Interval    uint
+	Ping        net.PingConfig
+	Degradation net.DegradationRules
+	Degraded    DegradedPolicy
+	IPv6        IPv6Policy
+	Diagnose    bool   // If true, localise the fault before resetting, and only reset for faults on the WAN side
+	RouterPing  string // A remote host pinged from the router itself while diagnosing, or empty to skip this step
+	// The local interface whose link is monitored, or empty to use the bound interface or the one routing to the router
+	LinkInterface string
+	MTU           MTUCheck
+	Throughput    ThroughputCheck
+	Router        RouterHealthCheck
+	Retry         RetryPolicy
+	Escalation    []EscalationStep // The remediation to take at each attempt, or nil to always redial
+	PowerCycle    []string         // The command run by the power-cycle escalation step
+	Budget        ResetBudget
+	Maintenance   []MaintenanceWindow // Periods during which the modem is not reset
+	PauseFile     string              // The file written by the pause command, or empty to ignore it
+	Scheduled     ScheduledReconnect
+	Hysteresis    Hysteresis
+	StateDir      string        // The directory the state is saved to across restarts, or empty to not save it
+	Notifiers     []Notifier    // Told of each event, e.g. to run hooks or send alerts
+	Reconnect     <-chan string // Requests for an immediate reconnect, naming their source, or nil
 
-	checker := net.NewPingChecker(remoteHosts, privileged)
+	StatusInterval time.Duration // The interval between status log lines, or 0 to disable them
+}
+
+// ThroughputCheck configures periodic throughput measurements, to catch a line that is up but running slowly
+type ThroughputCheck struct {
+	Probe    net.ThroughputConfig
+	Interval time.Duration // The minimum time between measurements, or 0 to disable them
+	MinMbps  float64       // The throughput below which a measurement is slow
+	Runs     int           // The number of consecutive slow measurements before the connection is slow
+	Reset    bool          // If true, reset the modem when the connection is slow
+}
+
+// MTUCheck configures a periodic check for an MTU black hole, where small packets pass but large ones are dropped
+type MTUCheck struct {
+	Expected int           // The packet size that should reach the first remote host, or 0 to disable the check
+	Sizes    []int         // The ladder of packet sizes to probe
+	Interval time.Duration // The minimum time between checks
+	Reset    bool          // If true, reset the modem when the largest working size is below the expected size
+}
+
+// DegradedPolicy controls how the watch loop responds to a connection that is up but degraded
+type DegradedPolicy struct {
+	Reset       bool          // If true, reset the modem when the connection becomes degraded
+	MinInterval time.Duration // The minimum time between resets triggered by degradation
+}
+
+// IPv6Policy controls how the watch loop responds to IPv6 connectivity failing while IPv4 is up
+type IPv6Policy struct {
+	Reset       bool          // If true, reset the modem when IPv6 connectivity is down
+	After       int           // The number of consecutive checks IPv6 must be down for before a reset
+	MinInterval time.Duration // The minimum time between resets triggered by IPv6
+}
+
+type watcher struct {
+	logger  log.Logger
+	conn    *t11c.Connection
+	checker *net.PingChecker
+	cfg     WatchConfig
+
+	history            *net.History
+	degraded           bool
+	lastDegradedReset  time.Time
+	ipv6Down           bool
+	ipv6Failures       int // Consecutive checks with IPv6 down while IPv4 is up
+	lastIPv6Reset      time.Time
+	linkDown           bool
+	linkUnknown        bool   // Set while the local link state cannot be read
+	linkInterface      string // The interface last found to route to the router
+	interfaceFor       func(host string) (*stdnet.Interface, error)
+	readLinkState      func(iface string) (net.LinkState, error)
+	routerFailures     int
+	routerUnresponsive bool
+	routerRtt          time.Duration
+	routerPingMu       sync.Mutex
+	gaveUp             bool // Set when resets have failed too many times, until the connection is seen up again
+	attempts           int  // Remediation steps taken since the connection was last up, so that an interrupted ladder resumes
+	limiter            *resetLimiter
+	suppressed         bool // Set while resets are suppressed by the reset budget
+	maintenance        bool // Set during a maintenance window or pause
+	state              connState
+	failures           int // Consecutive failed checks
+	successes          int // Consecutive successful checks
+	firstFailure       time.Time
+	downSince          time.Time
+	upSince            time.Time
+	lastReset          time.Time
+	totalResets        int
+	savedState         []byte // The last state written to the state file
+	lastResult         net.CheckResult
+	wanIP              stdnet.IP
+	wanIPChecked       time.Time
+	nextScheduled      time.Time
+	trafficSample      t11c.TrafficCounters // The WAN traffic counters when the traffic rate was last sampled
+	trafficSampled     time.Time
+	lastMTUCheck       time.Time
+	mtuBlackHole       bool // Set when the last conclusive MTU check found a black hole
+	lastSpeedtest      time.Time
+	slowSpeedtests     int
+	lastStatus         time.Time
+}
+
+func newWatcher(logger log.Logger, conn *t11c.Connection, cfg WatchConfig) *watcher {
+	w := &watcher{
+		logger:  logger,
+		conn:    conn,
+		checker: net.NewPingChecker(cfg.Ping),
+		cfg:     cfg,
+		history: net.NewHistory(cfg.Degradation),
+		limiter: &resetLimiter{budget: cfg.Budget},
+
+		interfaceFor:  net.InterfaceFor,
+		readLinkState: net.ReadLinkState,
+	}
+	w.checker.RouterPing = w.routerPing
+	return w
+}
+
+func WatchReset(ctx context.Context, logger log.Logger, conn *t11c.Connection, cfg WatchConfig) {
+	level.Info(logger).Log("interval", cfg.Interval, "remote_hosts", formatTargets(cfg.Ping.Targets, false), "quorum", cfg.Ping.Quorum.FailWeight, "remote_hosts6", formatTargets(cfg.Ping.Targets, true), "msg", "starting monitoring")
+
+	w := newWatcher(logger, conn, cfg)
+	w.loadState()
+	defer w.saveState()
+	defer func() {
+		for _, n := range cfg.Notifiers {
+			n.Close()
+		}
+	}()
 
 	// Run a check immediately, unless the context has already been cancelled
 	select {
@@ -23,74 +157,411 @@ func WatchReset(ctx context.Context, logger log.Logger, conn *t11c.Connection, i
 		level.Info(logger).Log("msg", "monitoring cancelled")
 		return
 	default:
-		checkReset(ctx, logger, conn, checker)
+		w.checkReset(ctx)
+		w.saveState()
+		w.report(ctx)
 	}
 
-	// After the initial check, start the ticker which will first trigger after the interval
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	defer ticker.Stop()
+	// After the initial check, start the timer which will first trigger after the interval. The interval is shorter
+	// while the connection state is changing.
+	timer := time.NewTimer(w.interval())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			level.Info(logger).Log("msg", "monitoring cancelled")
 			return
-		case <-ticker.C:
-			checkReset(ctx, logger, conn, checker)
+		case <-timer.C:
+			w.checkReset(ctx)
+			w.saveState()
+			w.report(ctx)
+			w.logStatus()
+			timer.Reset(w.interval())
+		case source := <-cfg.Reconnect:
+			w.requestedReconnect(ctx, source)
+			w.saveState()
+			w.report(ctx)
 		}
 	}
 }
 
-func checkReset(ctx context.Context, logger log.Logger, conn *t11c.Connection, checker net.PingChecker) {
-	up, err := checker.CheckRemoteConnectivity(ctx, logger)
+func (w *watcher) checkReset(ctx context.Context) {
+	if !w.checkLink() {
+		// An unknown link is still probed and logged, but must not lead to resets or router actions
+		if !w.linkUnknown {
+			return
+		}
+	} else if !w.checkRouter(ctx) {
+		return
+	}
+	// Router-ping targets log in to the router, which should be left alone during maintenance
+	w.checker.SkipRouter = w.checkMaintenance(time.Now())
+
+	result, err := w.checker.CheckRemoteConnectivity(ctx, w.logger)
 	if err != nil {
-		level.Error(logger).Log("msg", "failed to start connectivity tests", "err", err)
+		level.Error(w.logger).Log("msg", "failed to start connectivity tests", "results", result.Summary(), "err", err)
+		return
+	}
+	w.lastResult = result
+
+	w.observe(result.Up, time.Now())
+	if w.state == stateUp && w.upSince.IsZero() {
+		w.upSince = time.Now()
+	}
+
+	if w.state == stateUp {
+		w.resumeRemediation(result)
+	}
+
+	switch w.state {
+	case stateSuspect, stateRecovering:
+		level.Debug(w.logger).Log("msg", "waiting for consecutive checks to agree", "state", w.state, "results", result.Summary())
+		return
+	case stateUp:
+		if w.linkUnknown {
+			level.Debug(w.logger).Log("msg", "connectivity ok, local link state is unknown", "results", result.Summary())
+			return
+		}
+		if w.checkIPv6(result) {
+			level.Info(w.logger).Log("msg", "resetting for IPv6 connectivity")
+			w.lastIPv6Reset = time.Now()
+			w.reset(ctx)
+			return
+		}
+		if w.checkDegraded(result) {
+			level.Info(w.logger).Log("msg", "resetting degraded connection")
+			w.lastDegradedReset = time.Now()
+			w.reset(ctx)
+			return
+		}
+		if w.checkMTU(ctx) {
+			level.Info(w.logger).Log("msg", "resetting for MTU black hole")
+			w.reset(ctx)
+			return
+		}
+		if w.checkThroughput(ctx) {
+			level.Info(w.logger).Log("msg", "resetting slow connection")
+			w.reset(ctx)
+			return
+		}
+		if w.checkSchedule(ctx, time.Now()) {
+			return
+		}
+		level.Debug(w.logger).Log("msg", "connectivity ok", "results", result.Summary())
+		return
+	}
+
+	if w.gaveUp {
+		level.Debug(w.logger).Log("msg", "connection is down, but remediation has given up", "results", result.Summary())
+		return
+	}
+	if w.linkUnknown {
+		level.Info(w.logger).Log("msg", "connection is down, not remediating while the local link state is unknown", "results", result.Summary())
+		return
+	}
+	// Diagnosing logs in to the router, which should be left alone during maintenance
+	if w.maintenance {
+		level.Info(w.logger).Log("msg", "connection is down, not remediating during maintenance", "results", result.Summary())
 		return
 	}
 
-	if up {
-		level.Debug(logger).Log("msg", "connectivity ok")
+	if !w.cfg.Diagnose {
+		level.Info(w.logger).Log("msg", "connection is down", "results", result.Summary())
+		w.reset(ctx)
 		return
 	}
 
-	level.Info(logger).Log("msg", "connection is down")
-	for {
-		if err := resetAndWait(ctx, logger, conn, checker); err != nil {
-			level.Warn(logger).Log("msg", "modem reset failed", "err", err)
+	layer := w.diagnose(ctx)
+	level.Info(w.logger).Log("msg", "connection is down", "fault_layer", layer, "results", result.Summary())
+	if !layer.WANSide() {
+		level.Warn(w.logger).Log("msg", "fault is not on the WAN side, skipping reset", "fault_layer", layer)
+		return
+	}
+	w.reset(ctx)
+}
+
+// logStatus periodically logs a summary of the watch state, including the health of each remote host
+func (w *watcher) logStatus() {
+	if w.cfg.StatusInterval == 0 || time.Since(w.lastStatus) < w.cfg.StatusInterval {
+		return
+	}
+	w.lastStatus = time.Now()
+
+	level.Info(w.logger).Log("msg", "status", "state", w.state, "link_down", w.linkDown, "link_unknown", w.linkUnknown, "degraded", w.degraded, "ipv6_down", w.ipv6Down, "router_unresponsive", w.routerUnresponsive, "router_response_time", w.routerRtt, "gave_up", w.gaveUp, "suppressed", w.suppressed, "total_resets", w.totalResets, "maintenance", w.maintenance, "target_health", net.FormatHealth(w.checker.Health()))
+}
+
+// resumeRemediation ends the incident once the connection is seen up, so that the escalation ladder starts again. While
+// IPv6 may still call for a reset, the incident lasts until IPv6 is up too, as a reset restores IPv4 whether or not it
+// fixed IPv6.
+func (w *watcher) resumeRemediation(result net.CheckResult) {
+	if w.cfg.IPv6.Reset && !result.IPv6Up {
+		return
+	}
+	w.attempts = 0
+	if w.gaveUp {
+		w.gaveUp = false
+		level.Info(w.logger).Log("msg", "connection is up, resuming remediation")
+	}
+}
+
+// checkIPv6 logs changes in IPv6 connectivity while IPv4 is up, and returns true if the policy calls for a reset
+func (w *watcher) checkIPv6(result net.CheckResult) bool {
+	if result.IPv6Up {
+		w.ipv6Failures = 0
+	} else {
+		w.ipv6Failures++
+	}
+	if result.IPv6Up != !w.ipv6Down {
+		w.ipv6Down = !result.IPv6Up
+		if w.ipv6Down {
+			level.Warn(w.logger).Log("msg", "IPv6 connectivity is down", "results", result.Summary())
+		} else {
+			level.Info(w.logger).Log("msg", "IPv6 connectivity restored")
+		}
+	}
+
+	if !w.ipv6Down || !w.cfg.IPv6.Reset || w.gaveUp {
+		return false
+	}
+	if w.ipv6Failures < w.cfg.IPv6.After {
+		level.Debug(w.logger).Log("msg", "waiting for consecutive checks before resetting for IPv6", "failures", w.ipv6Failures, "reset_after", w.cfg.IPv6.After)
+		return false
+	}
+	if !w.lastIPv6Reset.IsZero() && time.Since(w.lastIPv6Reset) < w.cfg.IPv6.MinInterval {
+		level.Debug(w.logger).Log("msg", "IPv6 reset skipped, too soon after the last", "last_reset", w.lastIPv6Reset)
+		return false
+	}
+	if w.cfg.Retry.MaxAttempts > 0 && w.attempts >= w.cfg.Retry.MaxAttempts {
+		w.gaveUp = true
+		w.emit(EventRemediationGaveUp, "IPv6 is still down after repeated resets, giving up until it is seen up", "attempts", strconv.Itoa(w.attempts))
+		return false
+	}
+	return true
+}
+
+// checkDegraded records the result in the rolling history, logs changes in the degraded state, and returns true if
+// the degraded policy calls for a reset
+func (w *watcher) checkDegraded(result net.CheckResult) bool {
+	if !w.cfg.Degradation.Enabled() {
+		return false
+	}
+
+	d := w.history.Observe(result)
+	level.Debug(w.logger).Log("loss", fmt.Sprintf("%.1f", d.Loss), "median_rtt", d.MedianRtt, "jitter", d.Jitter, "breaches", d.Breaches, "msg", "connection quality")
+
+	if d.Degraded != w.degraded {
+		w.degraded = d.Degraded
+		if d.Degraded {
+			level.Warn(w.logger).Log("msg", "connection is degraded", "reasons", strings.Join(d.Reasons, "; "), "results", result.Summary())
 		} else {
-			level.Info(logger).Log("msg", "connection restored")
-			break
+			level.Info(w.logger).Log("msg", "connection is no longer degraded")
 		}
 	}
+
+	if !d.Degraded || !w.cfg.Degraded.Reset {
+		return false
+	}
+	if !w.lastDegradedReset.IsZero() && time.Since(w.lastDegradedReset) < w.cfg.Degraded.MinInterval {
+		level.Debug(w.logger).Log("msg", "degraded reset skipped, too soon after the last", "last_reset", w.lastDegradedReset)
+		return false
+	}
+	return true
 }
 
-func resetAndWait(ctx context.Context, logger log.Logger, conn *t11c.Connection, checker net.PingChecker) error {
-	level.Info(logger).Log("msg", "resetting modem")
+// checkMTU probes the path MTU to the first remote host if the check is due, and returns true if a black hole was found
+// and the policy calls for a reset
+func (w *watcher) checkMTU(ctx context.Context) bool {
+	if w.cfg.MTU.Expected == 0 || len(w.cfg.Ping.Targets) == 0 {
+		return false
+	}
+	if !w.lastMTUCheck.IsZero() && time.Since(w.lastMTUCheck) < w.cfg.MTU.Interval {
+		return false
+	}
+	w.lastMTUCheck = time.Now()
 
-	valid, err := conn.TestSession(ctx)
+	target := w.cfg.Ping.Targets[0]
+	result, err := w.checker.ProbeMTU(ctx, target, w.cfg.MTU.Sizes)
 	if err != nil {
-		level.Error(logger).Log("msg", "failed to check session", "err", err)
-		return err
+		level.Warn(w.logger).Log("msg", "failed to probe MTU", "remote_host", target.Host, "err", err)
+		return false
 	}
 
-	if !valid {
-		if err := conn.Login(ctx); err != nil {
-			level.Error(logger).Log("msg", "failed to login", "err", err)
-			return err
+	blackHole, conclusive := result.BlackHole(w.cfg.MTU.Expected)
+	if !conclusive {
+		// The remote host may be down or demoted while the quorum is still up, which is no reason to reset
+		level.Info(w.logger).Log("msg", "MTU check inconclusive, the smallest size was not answered", "remote_host", target.Host)
+		return false
+	}
+	w.mtuBlackHole = blackHole
+	if !blackHole {
+		level.Debug(w.logger).Log("msg", "MTU ok", "remote_host", target.Host, "largest_size", result.Largest)
+		return false
+	}
+
+	w.emit(EventMTUBlackHole, "packets below the expected MTU are being dropped", "remote_host", target.Host, "largest_size", strconv.Itoa(result.Largest), "expected_size", strconv.Itoa(w.cfg.MTU.Expected))
+	return w.cfg.MTU.Reset
+}
+
+// checkThroughput measures throughput if a measurement is due, and returns true if the connection has been slow for
+// enough consecutive measurements and the policy calls for a reset
+func (w *watcher) checkThroughput(ctx context.Context) bool {
+	if w.cfg.Throughput.Interval == 0 {
+		return false
+	}
+	if !w.lastSpeedtest.IsZero() && time.Since(w.lastSpeedtest) < w.cfg.Throughput.Interval {
+		return false
+	}
+	w.lastSpeedtest = time.Now()
+
+	result, err := net.MeasureThroughput(ctx, w.cfg.Throughput.Probe)
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to measure throughput", "err", err)
+		return false
+	}
+
+	mbps := fmt.Sprintf("%.2f", result.Mbps())
+	if result.Mbps() >= w.cfg.Throughput.MinMbps {
+		level.Debug(w.logger).Log("msg", "throughput ok", "mbps", mbps, "ttfb", result.TTFB)
+		w.slowSpeedtests = 0
+		return false
+	}
+
+	w.slowSpeedtests++
+	level.Info(w.logger).Log("msg", "throughput is low", "mbps", mbps, "ttfb", result.TTFB, "slow_runs", w.slowSpeedtests)
+	if w.slowSpeedtests < w.cfg.Throughput.Runs {
+		return false
+	}
+
+	// Only report the transition, rather than every slow measurement after it
+	if w.slowSpeedtests == w.cfg.Throughput.Runs {
+		w.emit(EventThroughputLow, "throughput has been low for consecutive measurements", "mbps", mbps, "min_mbps", fmt.Sprintf("%.2f", w.cfg.Throughput.MinMbps), "runs", strconv.Itoa(w.slowSpeedtests))
+	}
+	return w.cfg.Throughput.Reset
+}
+
+// reset works through the escalation ladder until the connection is restored. It carries on from the last step taken,
+// as remediation may have been interrupted by maintenance, the reset budget or an unresponsive router.
+func (w *watcher) reset(ctx context.Context) {
+	for {
+		attempt := w.attempts + 1
+		step := w.escalationStep(attempt)
+		if step.Action == ActionAlert {
+			w.gaveUp = true
+			w.emit(EventRemediationGaveUp, "escalation reached the alert step, giving up until the connection is seen up", "attempts", strconv.Itoa(w.attempts))
+			return
 		}
+
+		if w.checkMaintenance(time.Now()) || !w.checkBudget() {
+			return
+		}
+		w.attempts = attempt
+		w.recordReset(time.Now())
+
+		w.emit(EventResetStarted, "taking remediation action", "attempt", strconv.Itoa(attempt), "action", string(step.Action))
+		err := w.runStep(ctx, step)
+		if err == nil {
+			w.emit(EventRemediationStep, "connection restored", "attempt", strconv.Itoa(attempt), "action", string(step.Action), "outcome", "restored")
+			w.afterReset()
+			return
+		}
+		if ctx.Err() != nil || !w.checkLink() {
+			return
+		}
+		w.emit(EventRemediationStep, "remediation step failed", "attempt", strconv.Itoa(attempt), "action", string(step.Action), "outcome", "failed", "err", err.Error())
+		// Retrying would only hammer a router that has stopped responding, so wait for it to recover instead
+		if !w.checkRouter(ctx) {
+			return
+		}
+
+		if w.cfg.Retry.MaxAttempts > 0 && attempt >= w.cfg.Retry.MaxAttempts {
+			w.gaveUp = true
+			w.emit(EventRemediationGaveUp, "modem reset failed repeatedly, giving up until the connection is seen up", "attempts", strconv.Itoa(attempt), "err", err.Error())
+			return
+		}
+
+		delay := w.cfg.Retry.delay(attempt)
+		level.Info(w.logger).Log("msg", "escalating remediation", "attempt", attempt+1, "action", w.escalationStep(attempt+1).Action, "delay", delay)
+		if !sleepContext(ctx, delay) {
+			return
+		}
+	}
+}
+
+// afterReset clears the state measured on the connection before a successful reset
+func (w *watcher) afterReset() {
+	attempts := w.attempts
+	w.declareUp(time.Now(), "reset")
+	// Only IPv4 is checked while waiting for the connection, so IPv6 must be seen up before the incident ends
+	if w.ipv6Down && w.cfg.IPv6.Reset {
+		w.attempts = attempts
+	}
+	w.upSince = time.Now()
+	// Quality measured before the reset no longer reflects the new connection
+	w.history.Reset()
+	w.degraded = false
+	// Black holes often appear after a reconnect, so check again straight away. A black hole that was already found may
+	// be beyond the modem, so it waits for the usual interval rather than causing a reset on every check.
+	if !w.mtuBlackHole {
+		w.lastMTUCheck = time.Time{}
 	}
+	w.slowSpeedtests = 0
+}
+
+// recordReset counts a reset against the budget, and saves the state straight away in case the process is restarted
+// during the reset
+func (w *watcher) recordReset(now time.Time) {
+	w.limiter.record(now)
+	w.lastReset = now
+	w.totalResets++
+	w.saveState()
+}
 
-	if err := conn.SetModemState(ctx, false); err != nil {
-		// If explicit disconnection fails, just attempt to connect anyway
-		level.Warn(logger).Log("msg", "failed to disconnect, will try reconnect alone", "err", err)
+// checkBudget emits an event when the reset budget is exhausted, and returns false while it is. Monitoring continues,
+// but only observes the connection until a reset is allowed again.
+func (w *watcher) checkBudget() bool {
+	wait, reason := w.limiter.allow(time.Now())
+	if wait == 0 {
+		if w.suppressed {
+			w.suppressed = false
+			level.Info(w.logger).Log("msg", "reset budget available, resuming remediation")
+		}
+		return true
+	}
+
+	if !w.suppressed {
+		w.suppressed = true
+		w.emit(EventResetSuppressed, "reset budget exhausted, observing only", "reason", reason, "next_allowed", time.Now().Add(wait).UTC().Format(time.RFC3339))
+	} else {
+		level.Debug(w.logger).Log("msg", "reset suppressed by budget", "reason", reason, "wait", wait)
 	}
+	return false
+}
 
-	if err := conn.SetModemState(ctx, true); err != nil {
-		level.Error(logger).Log("msg", "failed to reconnect modem", "err", err)
+// ensureSession logs in to the router, unless the existing session is still valid
+func (w *watcher) ensureSession(ctx context.Context) error {
+	valid, err := w.conn.TestSession(ctx)
+	if err != nil {
+		level.Error(w.logger).Log("msg", "failed to check session", "err", err)
 		return err
 	}
 
-	level.Info(logger).Log("msg", "reset complete, waiting for connectivity")
-	err = checker.WaitForRemoteConnectivity(ctx, logger)
-	return err
+	if !valid {
+		if err := w.conn.Login(ctx); err != nil {
+			level.Error(w.logger).Log("msg", "failed to login", "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTargets(targets []net.Target, ipv6 bool) string {
+	hosts := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if t.IPv6 != ipv6 {
+			continue
+		}
+		hosts = append(hosts, t.String())
+	}
+	return strings.Join(hosts, ",")
 }
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ks07/t11c-reset/pkg/net"
+	"github.com/ks07/t11c-reset/pkg/t11c"
+)
+
+type unreachableResolver struct{}
+
+func (unreachableResolver) LookupIPAddr(ctx context.Context, host string) ([]stdnet.IPAddr, error) {
+	return nil, &stdnet.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+}
+
+// fakeRouter serves just enough of the T11C web interface to reset the modem, and records the requested dial states,
+// or "retrain" and "reboot" for the maintenance actions
+func fakeRouter(t *testing.T, onDial func(flag string)) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/main.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/cgi-bin/PPPoEManulDial.asp", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		onDial(r.PostForm.Get("DipConnFlag"))
+	})
+	mux.HandleFunc("/cgi-bin/pages/maintenance/diagnostics/adslRetrain.cgi", func(w http.ResponseWriter, r *http.Request) {
+		onDial("retrain")
+	})
+	mux.HandleFunc("/cgi-bin/pages/maintenance/reboot/reboot.cgi", func(w http.ResponseWriter, r *http.Request) {
+		onDial("reboot")
+	})
+	return httptest.NewServer(mux)
+}
+
+// testWatcher creates a watcher that manages the given router. Unless the config gives remote hosts, the only remote
+// host never resolves, so every check finds the connection down and every wait for it to recover fails.
+func testWatcher(t *testing.T, router *httptest.Server, cfg WatchConfig) *watcher {
+	routerURL, err := url.Parse(router.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Interval == 0 {
+		cfg.Interval = 15
+	}
+	if len(cfg.Ping.Targets) == 0 {
+		cfg.Ping.Targets = []net.Target{{Host: "one.one.one.one", Weight: 1}}
+		cfg.Ping.Resolver = unreachableResolver{}
+		cfg.Ping.Recovery.MaxWait = 100 * time.Millisecond
+	}
+
+	logger := log.NewNopLogger()
+	conn := t11c.NewConnection(logger, false, "admin", "admin", routerURL.Host)
+	return newWatcher(logger, conn, cfg)
+}
+
+func TestCheckResetWithoutDNS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var dials []string
+	router := fakeRouter(t, func(flag string) {
+		dials = append(dials, flag)
+		if flag == "1" {
+			// Stop waiting for the connection to recover once the modem has been reconnected
+			cancel()
+		}
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{})
+
+	w.checkReset(ctx)
+
+	assert.Equal(t, []string{"2", "1"}, dials, "An unresolvable hostname target should trigger a disconnect and reconnect")
+	assert.True(t, errors.Is(ctx.Err(), context.Canceled), "The reset should complete before the test timeout")
+}
+
+func TestCheckResetUnknownLink(t *testing.T) {
+	ctx := context.Background()
+	var dials []string
+	router := fakeRouter(t, func(flag string) {
+		dials = append(dials, flag)
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{LinkInterface: "eth0"})
+	w.readLinkState = func(iface string) (net.LinkState, error) {
+		return net.LinkState{}, errors.New("no such device")
+	}
+
+	w.checkReset(ctx)
+
+	assert.True(t, w.linkUnknown)
+	assert.Equal(t, stateDown, w.state, "The connection should still be probed while the link state is unknown")
+	assert.Empty(t, dials, "The modem should not be reset while the link state is unknown")
+}
+
+func TestResetGivesUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var dials []string
+	router := fakeRouter(t, func(flag string) {
+		dials = append(dials, flag)
+	})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{
+		Retry: RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+	})
+
+	// The unresolvable target fails both the check and every wait for the connection to recover
+	w.checkReset(ctx)
+	assert.Equal(t, []string{"2", "1", "2", "1"}, dials, "The reset should be attempted the maximum number of times")
+	assert.True(t, w.gaveUp, "Remediation should give up after the maximum attempts")
+
+	w.checkReset(ctx)
+	assert.Len(t, dials, 4, "No further resets should be attempted after giving up")
+}
+
+func TestIPv6ResetLimited(t *testing.T) {
+	router := fakeRouter(t, func(string) {})
+	defer router.Close()
+
+	w := testWatcher(t, router, WatchConfig{
+		IPv6:  IPv6Policy{Reset: true, After: 2, MinInterval: time.Hour},
+		Retry: RetryPolicy{MaxAttempts: 2},
+	})
+	ipv6Down := net.CheckResult{Up: true, IPv6Up: false}
+	check := func(result net.CheckResult) bool {
+		w.resumeRemediation(result)
+		return w.checkIPv6(result)
+	}
+
+	assert.False(t, check(ipv6Down), "A single failed check should not reset")
+	assert.True(t, check(ipv6Down), "Consecutive failed checks should reset")
+
+	// The redial restores IPv4, but IPv6 stays down across the next checks
+	w.lastIPv6Reset = time.Now()
+	w.attempts = 1
+	w.afterReset()
+	assert.False(t, check(ipv6Down), "Another reset should wait for the minimum interval")
+	assert.False(t, check(ipv6Down))
+	assert.Equal(t, 1, w.attempts, "The attempts should be kept while IPv6 is down")
+
+	w.lastIPv6Reset = time.Now().Add(-2 * time.Hour)
+	assert.True(t, check(ipv6Down), "IPv6 should be reset again after the minimum interval")
+	w.attempts = 2
+	w.afterReset()
+	w.lastIPv6Reset = time.Now().Add(-2 * time.Hour)
+	assert.False(t, check(ipv6Down), "IPv6 resets should stop after the maximum attempts")
+	assert.True(t, w.gaveUp)
+
+	assert.False(t, check(net.CheckResult{Up: true, IPv6Up: true}))
+	assert.Zero(t, w.attempts, "The attempts should be cleared once IPv6 is up")
+	assert.False(t, w.gaveUp)
+}
+
+func TestMTUCheckAfterReset(t *testing.T) {
+	router := fakeRouter(t, func(string) {})
+	defer router.Close()
+	w := testWatcher(t, router, WatchConfig{})
+
+	checked := time.Now()
+	w.lastMTUCheck = checked
+	w.afterReset()
+	assert.True(t, w.lastMTUCheck.IsZero(), "The MTU should be checked straight after a reset")
+
+	// A reset for a black hole that is beyond the modem must not lead to a reset on every check
+	w.lastMTUCheck = checked
+	w.mtuBlackHole = true
+	w.afterReset()
+	assert.Equal(t, checked, w.lastMTUCheck, "The MTU check should wait for its interval after a reset for a black hole")
+}
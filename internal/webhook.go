@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// DefaultNotifyEvents are the events sent by notifiers that are not given a list of events
+var DefaultNotifyEvents = []EventKind{EventConnectionDown, EventResetStarted, EventConnectionUp, EventRemediationGaveUp}
+
+// WebhookConfig configures a webhook notifier
+type WebhookConfig struct {
+	URL         string
+	Template    *template.Template // Renders the request body from an Event, or nil to send the event as JSON
+	ContentType string
+	Events      []EventKind // The events to send, or nil for DefaultNotifyEvents
+	Queue       QueueConfig
+}
+
+// ParseWebhookTemplate parses a Go template for webhook bodies. Templates are executed with an Event, and may use the
+// json function to quote a value, e.g. {"text": {{ printf "%s: %s" .Kind .Message | json }}}
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// Webhook is a Notifier that POSTs each event to a URL
+type Webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+	queue  *deliveryQueue
+}
+
+// NewWebhook creates a Webhook and starts delivering its queue in the background
+func NewWebhook(logger log.Logger, cfg WebhookConfig) *Webhook {
+	if cfg.Events == nil {
+		cfg.Events = DefaultNotifyEvents
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+
+	wh := &Webhook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	wh.queue = newDeliveryQueue(log.With(logger, "webhook", cfg.URL), cfg.Queue, 1, wh.send)
+	return wh
+}
+
+func (wh *Webhook) Notify(ev Event) {
+	if wantsEvent(wh.cfg.Events, ev.Kind) {
+		wh.queue.push(ev)
+	}
+}
+
+func (wh *Webhook) Close() {
+	wh.queue.close()
+}
+
+func (wh *Webhook) render(ev Event) ([]byte, error) {
+	if wh.cfg.Template == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := wh.cfg.Template.Execute(&buf, ev); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (wh *Webhook) send(ctx context.Context, events []Event) error {
+	body, err := wh.render(events[0])
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to render body: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", wh.cfg.ContentType)
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		// Other client errors will be rejected again, so are not retried
+		if resp.StatusCode >= 400 && resp.StatusCode <= 499 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			// Simulate the outage that the event describes
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	tmpl, err := ParseWebhookTemplate(`{"text": {{ printf "%s after %s" .Message (index .Details "outage") | json }}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := NewWebhook(log.NewNopLogger(), WebhookConfig{
+		URL:      server.URL,
+		Template: tmpl,
+		Queue:    QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, Size: 10},
+	})
+
+	wh.Notify(Event{Kind: EventConnectionDown, Time: time.Now(), Message: "connection is down", Details: map[string]string{}})
+	wh.Notify(Event{Kind: EventLinkUp, Time: time.Now(), Message: "not sent"})
+	wh.Notify(Event{Kind: EventConnectionUp, Time: time.Now(), Message: "connection is up", Details: map[string]string{"outage": "5m0s"}})
+	wh.Close()
+
+	assert.Equal(t, []string{
+		`{"text": "connection is down after "}`,
+		`{"text": "connection is up after 5m0s"}`,
+	}, bodies, "Queued events should be retried and delivered in order, and unwanted events skipped")
+}
+
+func TestWebhookDropsOldEvents(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(log.NewNopLogger(), WebhookConfig{
+		URL:   server.URL,
+		Queue: QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, MaxAge: time.Minute, Size: 1},
+	})
+	wh.Notify(Event{Kind: EventConnectionDown, Time: time.Now().Add(-time.Hour)})
+	wh.Close()
+
+	assert.Equal(t, 1, requests, "An event older than the maximum age should not be retried")
+}
+
+func TestWebhookDropsRejectedEvents(t *testing.T) {
+	var mu sync.Mutex
+	var requests []int
+	statuses := []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		status := statuses[len(requests)]
+		requests = append(requests, status)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(log.NewNopLogger(), WebhookConfig{
+		URL:   server.URL,
+		Queue: QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, Size: 10},
+	})
+	wh.Notify(Event{Kind: EventConnectionDown, Time: time.Now()})
+	wh.Notify(Event{Kind: EventConnectionUp, Time: time.Now()})
+	wh.Close()
+	assert.Equal(t, statuses, requests, "A rejected event should be dropped, and a rate limited event retried")
+
+	tmpl, err := ParseWebhookTemplate(`{{ .Missing }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests = nil
+	wh = NewWebhook(log.NewNopLogger(), WebhookConfig{
+		URL:      server.URL,
+		Template: tmpl,
+		Queue:    QueueConfig{Retry: RetryPolicy{Backoff: time.Millisecond}, Size: 10},
+	})
+	wh.Notify(Event{Kind: EventConnectionDown, Time: time.Now()})
+	wh.Close()
+	assert.Empty(t, requests, "An event whose body cannot be rendered should be dropped")
+}
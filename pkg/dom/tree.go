@@ -1,6 +1,10 @@
 package dom
 
-import "golang.org/x/net/html"
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
 
 func GetID(n *html.Node) (bool, string) {
 	for _, attr := range n.Attr {
@@ -37,3 +41,19 @@ func FindBodyElement(id string, n *html.Node) *html.Node {
 
 	return nil
 }
+
+// Text returns the concatenated text of n and all of its descendants
+func Text(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
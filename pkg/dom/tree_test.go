@@ -153,3 +153,19 @@ func TestFindBodyElement(t *testing.T) {
 	n = FindBodyElement("targetid", doc)
 	assert.Nil(t, n, "Should not find a node in the head section")
 }
+
+func TestText(t *testing.T) {
+	const srcNested = `<div id="result"><pre>PING 1.1.1.1
+</pre><p>4 packets <b>transmitted</b></p></div>`
+	n, err := nodeFromString(srcNested)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "PING 1.1.1.1\n4 packets transmitted", Text(n), "Should concatenate the text of all descendants")
+
+	n, err = nodeFromString(`<br>`)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "", Text(n), "Should return an empty string for a node without text")
+}
@@ -0,0 +1,109 @@
+package net
+
+import (
+	"fmt"
+	stdnet "net"
+	"syscall"
+)
+
+// Binding selects the local address or interface that outgoing probes and requests are sent from. This prevents
+// traffic escaping via another route on a multi-homed host, e.g. a backup link, and reporting success.
+type Binding struct {
+	Address   stdnet.IP // The source address to send from
+	Interface string    // The name of the interface to send from
+}
+
+// ParseBinding interprets s as a source address if it is a valid IP, or as an interface name otherwise
+func ParseBinding(s string) Binding {
+	if s == "" {
+		return Binding{}
+	}
+	if ip := stdnet.ParseIP(s); ip != nil {
+		return Binding{Address: ip}
+	}
+	return Binding{Interface: s}
+}
+
+// IsZero returns true if no binding is configured
+func (b Binding) IsZero() bool {
+	return b.Address == nil && b.Interface == ""
+}
+
+func (b Binding) String() string {
+	if b.Address != nil {
+		return b.Address.String()
+	}
+	return b.Interface
+}
+
+// Validate checks that the interface exists, or that the address is assigned to a local interface and is in the same
+// address family as the given targets
+func (b Binding) Validate(targets ...Target) error {
+	if b.Interface != "" {
+		if !interfaceBindingSupported {
+			return fmt.Errorf("invalid bind interface %q: binding to an interface is not supported on this platform", b.Interface)
+		}
+		if _, err := stdnet.InterfaceByName(b.Interface); err != nil {
+			return fmt.Errorf("invalid bind interface %q: %w", b.Interface, err)
+		}
+		return nil
+	}
+
+	if b.Address != nil {
+		addrs, err := stdnet.InterfaceAddrs()
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*stdnet.IPNet); ok && ipNet.IP.Equal(b.Address) {
+				return b.validateFamily(targets)
+			}
+		}
+		return fmt.Errorf("invalid bind address %s: not assigned to any local interface", b.Address)
+	}
+
+	return nil
+}
+
+func (b Binding) validateFamily(targets []Target) error {
+	ipv6 := b.Address.To4() == nil
+	for _, t := range targets {
+		// Router pings are sent by the router, not from the bound address
+		if t.IPv6 != ipv6 && !t.Router {
+			return fmt.Errorf("invalid bind address %s: cannot reach remote host %s in another address family", b.Address, t.Host)
+		}
+	}
+	return nil
+}
+
+// SourceAddr returns the local address to send from when talking to dest, or an empty string if no address is bound
+func (b Binding) SourceAddr(dest stdnet.IP) (string, error) {
+	if b.Address == nil {
+		return "", nil
+	}
+	if (b.Address.To4() == nil) != (dest.To4() == nil) {
+		return "", fmt.Errorf("bind address %s cannot reach %s", b.Address, dest)
+	}
+	return b.Address.String(), nil
+}
+
+// Dialer returns a dialer that makes connections from the bound address or interface
+func (b Binding) Dialer() *stdnet.Dialer {
+	dialer := &stdnet.Dialer{}
+	if b.Address != nil {
+		dialer.LocalAddr = &stdnet.TCPAddr{IP: b.Address}
+	}
+	if b.Interface != "" {
+		iface := b.Interface
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			var bindErr error
+			if err := c.Control(func(fd uintptr) {
+				bindErr = platformBindToInterface(fd, iface)
+			}); err != nil {
+				return err
+			}
+			return bindErr
+		}
+	}
+	return dialer
+}
@@ -0,0 +1,10 @@
+package net
+
+import "golang.org/x/sys/unix"
+
+const interfaceBindingSupported = true
+
+// On Linux, sockets can be bound directly to an interface, which also selects the route used
+func platformBindToInterface(fd uintptr, iface string) error {
+	return unix.BindToDevice(int(fd), iface)
+}
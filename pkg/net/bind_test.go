@@ -0,0 +1,37 @@
+package net
+
+import (
+	stdnet "net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBinding(t *testing.T) {
+	assert.True(t, ParseBinding("").IsZero())
+	assert.Equal(t, Binding{Address: stdnet.ParseIP("192.0.2.10")}, ParseBinding("192.0.2.10"))
+	assert.Equal(t, Binding{Interface: "eth0"}, ParseBinding("eth0"))
+}
+
+func TestBindingValidate(t *testing.T) {
+	assert.NoError(t, Binding{}.Validate(), "No binding should always be valid")
+	assert.NoError(t, ParseBinding("127.0.0.1").Validate(), "The loopback address should be assigned locally")
+	assert.Error(t, ParseBinding("192.0.2.10").Validate(), "Should reject an address that isn't assigned locally")
+	assert.Error(t, ParseBinding("no-such-interface0").Validate(), "Should reject an interface that doesn't exist")
+	assert.NoError(t, ParseBinding("127.0.0.1").Validate(Target{Host: "192.0.2.1"}))
+	assert.Error(t, ParseBinding("127.0.0.1").Validate(Target{Host: "192.0.2.1"}, Target{Host: "2001:db8::1", IPv6: true}), "Should reject an IPv6 remote host with an IPv4 bind address")
+}
+
+func TestBindingSourceAddr(t *testing.T) {
+	src, err := Binding{}.SourceAddr(stdnet.ParseIP("1.1.1.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", src, "No binding should leave the source unset")
+
+	b := ParseBinding("192.0.2.10")
+	src, err = b.SourceAddr(stdnet.ParseIP("1.1.1.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.10", src)
+
+	_, err = b.SourceAddr(stdnet.ParseIP("2606:4700:4700::1111"))
+	assert.Error(t, err, "An IPv4 source should not be used for an IPv6 destination")
+}
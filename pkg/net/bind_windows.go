@@ -0,0 +1,10 @@
+package net
+
+import "errors"
+
+const interfaceBindingSupported = false
+
+// Windows has no equivalent of SO_BINDTODEVICE, so a source address must be bound instead
+func platformBindToInterface(_ uintptr, _ string) error {
+	return errors.New("binding to an interface is not supported on Windows, bind to its address instead")
+}
@@ -3,119 +3,540 @@ package net
 import (
 	"context"
 	"errors"
+	"fmt"
+	stdnet "net"
+	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/sparrc/go-ping"
 )
 
 const downThreshold = 100.0 // The packet loss proportion below which the connection is considered up
-const pingsRequired = 2     // The number of responses required before the connection is deemed restored
+
+// resolveRetry is how often an unresolved target is looked up again while waiting for the connection to recover
+const resolveRetry = time.Second
+
+// routerPingPrefix marks a target that is pinged by the router rather than this machine
+const routerPingPrefix = "router-ping:"
+
+// Target is a remote host to be probed, and the weight its failure carries in the outage decision
+type Target struct {
+	Host   string
+	Weight uint
+	IPv6   bool // If true, the target is probed over IPv6 rather than IPv4
+	Router bool // If true, the target is pinged by the router itself, using a RouterPingFunc
+}
+
+// ParseTarget parses a target in the form "host" or "host=weight", optionally prefixed with "router-ping:" for a host
+// that is pinged by the router itself. Targets without a weight have a weight of 1.
+func ParseTarget(s string) (Target, error) {
+	var t Target
+	spec := s
+	if strings.HasPrefix(spec, routerPingPrefix) {
+		spec = strings.TrimPrefix(spec, routerPingPrefix)
+		t.Router = true
+	}
+
+	host, weightText, hasWeight := cutLast(spec, "=")
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing host", s)
+	}
+
+	t.Host = host
+	t.Weight = 1
+	if hasWeight {
+		weight, err := strconv.ParseUint(strings.TrimSpace(weightText), 10, 32)
+		if err != nil || weight == 0 {
+			return Target{}, fmt.Errorf("invalid target %q: weight must be a positive integer", s)
+		}
+		t.Weight = uint(weight)
+	}
+	return t, nil
+}
+
+// String formats a target in the form accepted by ParseTarget
+func (t Target) String() string {
+	s := t.Host
+	if t.Router {
+		s = routerPingPrefix + s
+	}
+	if t.Weight != 1 {
+		s = fmt.Sprintf("%s=%d", s, t.Weight)
+	}
+	return s
+}
+
+// ParseTargets parses each of the given strings with ParseTarget, as IPv4 or IPv6 targets
+func ParseTargets(ss []string, ipv6 bool) ([]Target, error) {
+	targets := make([]Target, 0, len(ss))
+	for _, s := range ss {
+		t, err := ParseTarget(s)
+		if err != nil {
+			return nil, err
+		}
+		if t.Router && ipv6 {
+			return nil, fmt.Errorf("invalid target %q: router-ping targets are only supported over IPv4", s)
+		}
+		if ip := stdnet.ParseIP(t.Host); ip != nil && (ip.To4() == nil) != ipv6 {
+			return nil, fmt.Errorf("invalid target %q: address is the wrong IP version", s)
+		}
+		t.IPv6 = ipv6
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Quorum decides whether the connection is down from the combined weight of the targets that failed
+type Quorum struct {
+	// FailWeight is the failed weight at or above which the connection is down. Zero requires every target to fail.
+	FailWeight uint
+}
+
+// Down returns true if the failed targets of the IP version in results meet the quorum
+func (q Quorum) Down(results []ProbeResult, ipv6 bool) bool {
+	var total, failed uint
+	for _, r := range results {
+		if r.Target.IPv6 != ipv6 {
+			continue
+		}
+		total += r.Target.Weight
+		if r.Failed() {
+			failed += r.Target.Weight
+		}
+	}
+
+	if total == 0 {
+		return false
+	}
+
+	threshold := q.FailWeight
+	if threshold == 0 || threshold > total {
+		threshold = total
+	}
+	return failed >= threshold
+}
+
+// ProbeResult holds the outcome of a ping burst against a single target
+type ProbeResult struct {
+	Target  Target
+	Sent    int
+	Recv    int
+	Loss    float64
+	AvgRtt  time.Duration
+	Rtts    []time.Duration
+	Err     error // Set if the probe could not be run
+	SendErr error // Set if any echo request could not be sent
+}
+
+// Failed returns true if the target could not be reached at all
+func (r ProbeResult) Failed() bool {
+	return r.Err != nil || r.Sent == 0 || r.Loss >= downThreshold
+}
+
+func (r ProbeResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s:error", r.Target.Host)
+	}
+	if r.Failed() {
+		return fmt.Sprintf("%s:%d/%d", r.Target.Host, r.Recv, r.Sent)
+	}
+	return fmt.Sprintf("%s:%d/%d:%s", r.Target.Host, r.Recv, r.Sent, r.AvgRtt.Round(time.Microsecond*100))
+}
+
+// CheckResult is the outcome of a single connectivity check across all targets
+type CheckResult struct {
+	Up      bool // The IPv4 quorum was met
+	IPv6Up  bool // The IPv6 quorum was met, always true if there are no IPv6 targets
+	Results []ProbeResult
+}
+
+// Summary formats the per-target results for logging
+func (cr CheckResult) Summary() string {
+	parts := make([]string, len(cr.Results))
+	for i, r := range cr.Results {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Average returns the mean round trip time of the targets that replied, or 0 if none did, and the mean packet loss,
+// as a percentage, of the targets that could be probed
+func (cr CheckResult) Average() (time.Duration, float64) {
+	var rtt time.Duration
+	var loss float64
+	var replied, probed int
+	for _, r := range cr.Results {
+		if r.Err != nil || r.Sent == 0 {
+			continue
+		}
+		probed++
+		loss += r.Loss
+		if r.Recv > 0 {
+			replied++
+			rtt += r.AvgRtt
+		}
+	}
+	if probed > 0 {
+		loss /= float64(probed)
+	}
+	if replied > 0 {
+		rtt /= time.Duration(replied)
+	}
+	return rtt, loss
+}
+
+// RouterPingFunc pings host from the router itself, returning the number of pings sent and answered, and the average
+// round trip time of the answers
+type RouterPingFunc func(ctx context.Context, host string, count int) (sent, recv int, avgRtt time.Duration, err error)
+
+// PingConfig holds the settings for a PingChecker
+type PingConfig struct {
+	Targets        []Target
+	Quorum         Quorum // The quorum for IPv4 targets
+	Quorum6        Quorum // The quorum for IPv6 targets
+	RawSocket      bool
+	Binding        Binding       // The local address or interface pings are sent from
+	Resolver       Resolver      // The resolver used for hostname targets, or nil for the system resolver
+	ResolveRefresh time.Duration // How long a resolved address is used before it is looked up again
+	Health         HealthPolicy
+	Recovery       RecoveryPolicy // The policy for deciding the connection has been restored after a reset
+	RouterPing     RouterPingFunc // Pings router-ping targets, or nil if they are not supported
+}
 
 type PingChecker struct {
-	Dests     []string
-	RawSocket bool
+	Targets    []Target
+	Quorum     Quorum
+	Quorum6    Quorum
+	RawSocket  bool
+	Binding    Binding
+	RouterPing RouterPingFunc
+	SkipRouter bool // If true, router-ping targets are left out of checks, e.g. while the router must be left alone
+	resolver   *resolverCache
+	Recovery   RecoveryPolicy
+	health     *healthTracker
 }
 
-func NewPingChecker(dest []string, rawSocket bool) PingChecker {
-	return PingChecker{
-		Dests:     dest,
-		RawSocket: rawSocket,
+func NewPingChecker(cfg PingConfig) *PingChecker {
+	return &PingChecker{
+		Targets:    cfg.Targets,
+		Quorum:     cfg.Quorum,
+		Quorum6:    cfg.Quorum6,
+		RawSocket:  cfg.RawSocket,
+		Binding:    cfg.Binding,
+		RouterPing: cfg.RouterPing,
+		Recovery:   cfg.Recovery.withDefaults(),
+		resolver:   newResolverCache(cfg.Resolver, cfg.ResolveRefresh),
+		health:     newHealthTracker(cfg.Health, cfg.Targets),
 	}
 }
 
-func (pc PingChecker) makePinger(ctx context.Context, dest string) (*ping.Pinger, error) {
-	pinger, err := ping.NewPinger(dest)
+// Health returns the recent history of each target
+func (pc *PingChecker) Health() []TargetHealth {
+	return pc.health.health()
+}
+
+func (pc *PingChecker) makePinger(ctx context.Context, dest Target) (*Pinger, error) {
+	addr, err := pc.resolver.resolve(ctx, dest.Host, dest.IPv6)
 	if err != nil {
 		return nil, err
 	}
 
-	// Run platform-specific setup for the ping socket
-	platformSetupPinger(pinger, pc.RawSocket)
-
-	// Immediately stop pinging if the context is cancelled
-	go func() {
-		<-ctx.Done()
-		pinger.Stop()
-	}()
+	pinger := NewPinger(addr)
+	pinger.RawSocket = pc.RawSocket
+	pinger.Interface = pc.Binding.Interface
+	if pinger.Source, err = pc.Binding.SourceAddr(addr.IP); err != nil {
+		return nil, err
+	}
 
 	return pinger, nil
 }
 
-func (pc PingChecker) CheckRemoteConnectivity(ctx context.Context, logger log.Logger) (bool, error) {
+// Probe sends a burst of pings to a single target
+func (pc *PingChecker) Probe(ctx context.Context, target Target) ProbeResult {
+	result := ProbeResult{Target: target}
+	if target.Router {
+		return pc.probeFromRouter(ctx, target)
+	}
+
+	pinger, err := pc.makePinger(ctx, target)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// We could just use a longer run, but we specifically want to run bursts in case of random packet loss
+	pinger.Count = 3
+	pinger.Interval = time.Second
+	pinger.Timeout = 4 * time.Second
+
+	stats, err := pinger.Run(ctx)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Sent = stats.Sent
+	result.Recv = stats.Recv
+	result.Loss = stats.Loss()
+	result.AvgRtt = stats.AvgRtt()
+	result.Rtts = stats.Rtts
+	result.SendErr = stats.SendErr
+	return result
+}
+
+// probeFromRouter asks the router to ping a router-ping target
+func (pc *PingChecker) probeFromRouter(ctx context.Context, target Target) ProbeResult {
+	result := ProbeResult{Target: target}
+	if pc.RouterPing == nil {
+		result.Err = errors.New("router-ping targets are not supported by this command")
+		return result
+	}
+
+	sent, recv, avgRtt, err := pc.RouterPing(ctx, target.Host, 3)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Sent = sent
+	result.Recv = recv
+	result.Loss = Statistics{Sent: sent, Recv: recv}.Loss()
+	result.AvgRtt = avgRtt
+	return result
+}
+
+// CheckRemoteConnectivity probes all targets that are not demoted concurrently, and applies the quorum to decide if the
+// connection is down
+func (pc *PingChecker) CheckRemoteConnectivity(ctx context.Context, logger log.Logger) (CheckResult, error) {
 	pingerCtx, pingerCancel := context.WithCancel(ctx)
 	defer pingerCancel()
 
-	for _, dest := range pc.Dests {
-		pinger, err := pc.makePinger(pingerCtx, dest)
-		if err != nil {
-			return false, err
+	targets := pc.health.active(pc.Targets, time.Now())
+	if pc.SkipRouter {
+		local := make([]Target, 0, len(targets))
+		for _, t := range targets {
+			if !t.Router {
+				local = append(local, t)
+			}
 		}
+		targets = local
+	}
+	results := make([]ProbeResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			results[i] = pc.Probe(pingerCtx, target)
+		}(i, target)
+	}
+	wg.Wait()
 
-		// We could just use pinger's interval setting, but we specifically want to run bursts in case of random packet loss
-		pinger.Count = 3
-		pinger.Timeout = 6 * time.Second
+	// A target that cannot be probed counts as a failure in its own address family, so one bad target cannot stop the
+	// check. A target that cannot be resolved is a symptom of an outage, so it is only logged at debug level.
+	for _, r := range results {
+		var resolveErr *ResolveError
+		switch {
+		case errors.As(r.Err, &resolveErr):
+			level.Debug(logger).Log("remote_host", r.Target.Host, "err", r.Err, "msg", "ping target unresolved")
+		case r.Err != nil:
+			level.Warn(logger).Log("remote_host", r.Target.Host, "err", r.Err, "msg", "failed to probe remote host")
+		default:
+			level.Debug(logger).Log("remote_host", r.Target.Host, "packets_sent", r.Sent, "packets_dropped", r.Sent-r.Recv, "latency", r.AvgRtt, "send_err", r.SendErr, "msg", "ping complete")
+		}
+	}
 
-		pinger.Run()
-		stats := pinger.Statistics()
+	// If no target in a family could be probed at all, the fault is local (e.g. no permission for raw sockets, or no
+	// IPv6 support) and says nothing about the connection
+	if err := unprobed(results, false); err != nil {
+		return CheckResult{Results: results}, err
+	}
+	ipv6Up := !pc.Quorum6.Down(results, true)
+	if err := unprobed(results, true); err != nil {
+		level.Warn(logger).Log("err", err, "msg", "no IPv6 remote host could be probed, ignoring IPv6 connectivity")
+		ipv6Up = true
+	}
 
-		// Need to check pings were actually attempted, as a workaround for https://github.com/sparrc/go-ping/issues/92
-		if stats.PacketsSent == 0 {
-			return false, errors.New("no ping packets were sent, potential configuration error")
-		}
+	for _, h := range pc.health.record(results, time.Now()) {
+		level.Warn(logger).Log("remote_host", h.Target.Host, "lone_failures", h.LoneFailures, "last_success", formatLastSuccess(h.LastSuccess), "demoted_until", h.DemotedUntil, "msg", "demoting remote host that fails while others respond")
+	}
 
-		level.Debug(logger).Log("remote_host", dest, "packets_sent", stats.PacketsSent, "packets_dropped", stats.PacketsSent-stats.PacketsRecv, "latency", stats.AvgRtt, "msg", "ping complete")
+	return CheckResult{
+		Up:      !pc.Quorum.Down(results, false),
+		IPv6Up:  ipv6Up,
+		Results: results,
+	}, nil
+}
 
-		// Only try the next host if the test failed
-		if stats.PacketLoss < downThreshold {
-			return true, nil
+// unprobed returns the error of the last target in the family if every target in it failed with an error other than
+// failing to resolve, or nil if any target could be probed
+func unprobed(results []ProbeResult, ipv6 bool) error {
+	var err error
+	for _, r := range results {
+		if r.Target.IPv6 != ipv6 {
+			continue
+		}
+		var resolveErr *ResolveError
+		if r.Err == nil || errors.As(r.Err, &resolveErr) {
+			return nil
 		}
+		err = r.Err
+	}
+	return err
+}
+
+func formatLastSuccess(t time.Time) string {
+	if t.IsZero() {
+		return "never"
 	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-	return false, nil
+// WaitForRemoteConnectivity pings all targets continuously until the recovery policy is satisfied, or the maximum wait
+// has passed
+func (pc *PingChecker) WaitForRemoteConnectivity(ctx context.Context, logger log.Logger) error {
+	return pc.WaitForRecovery(ctx, logger, pc.Recovery)
 }
 
-func (pc PingChecker) WaitForRemoteConnectivity(ctx context.Context, logger log.Logger) error {
-	var wg sync.WaitGroup
-	var pingsReceived uint32
-	pingerCtx, pingerCancel := context.WithCancel(ctx)
+// WaitForRecovery is WaitForRemoteConnectivity with the given recovery policy, rather than the configured one. Targets
+// that cannot be resolved are looked up again throughout the wait, as DNS is often the last thing to come back.
+func (pc *PingChecker) WaitForRecovery(ctx context.Context, logger log.Logger, policy RecoveryPolicy) error {
+	policy = policy.withDefaults()
+	pingerCtx, pingerCancel := context.WithTimeout(ctx, policy.MaxWait)
 	defer pingerCancel()
 
-	var pingers []*ping.Pinger
-	for _, dest := range pc.Dests {
-		pinger, err := pc.makePinger(pingerCtx, dest)
-		if err != nil {
-			return err
+	type pingEvent struct {
+		target Target
+		ok     bool
+		at     time.Time
+	}
+	type pingFailure struct {
+		target Target
+		err    error
+	}
+	events := make(chan pingEvent)
+	started := make(chan Target)
+	failures := make(chan pingFailure)
+	notify := func(ev pingEvent) {
+		select {
+		case events <- ev:
+		case <-pingerCtx.Done():
+		}
+	}
+
+	var wg sync.WaitGroup
+	waiting := 0
+	for _, target := range pc.health.active(pc.Targets, time.Now()) {
+		// The router's diagnostics page only reports once all of its pings are done, so cannot be followed continuously
+		if target.Router {
+			continue
 		}
 
-		pinger.Timeout = 30 * time.Second
+		waiting++
+		wg.Add(1)
+		go func(target Target) {
+			defer wg.Done()
+			pinger, err := pc.recoveryPinger(pingerCtx, logger, target)
+			if err == nil {
+				pinger.Interval = time.Second
+				pinger.Timeout = 2 * time.Second
+				pinger.Count = int(policy.MaxWait/pinger.Interval) + 1
+				pinger.OnRecv = func(reply Reply) {
+					level.Debug(logger).Log("remote_host", target.Host, "seq", reply.Seq, "latency", reply.Rtt, "msg", "ping reply")
+					notify(pingEvent{target: target, ok: true, at: time.Now()})
+				}
+				pinger.OnLoss = func(seq int) {
+					notify(pingEvent{target: target, ok: false, at: time.Now()})
+				}
 
-		pinger.OnRecv = func(pkt *ping.Packet) {
-			newPingsReceived := atomic.AddUint32(&pingsReceived, 1)
-			level.Debug(logger).Log("remote_host", dest, "packets_received", newPingsReceived, "latency", pkt.Rtt, "msg", "connection restored")
-			if newPingsReceived >= pingsRequired {
-				pingerCancel()
+				select {
+				case started <- target:
+				case <-pingerCtx.Done():
+					return
+				}
+				_, err = pinger.Run(pingerCtx)
 			}
-		}
+			if err != nil && pingerCtx.Err() == nil {
+				select {
+				case failures <- pingFailure{target: target, err: err}:
+				case <-pingerCtx.Done():
+				}
+			}
+		}(target)
+	}
+	defer func() {
+		pingerCancel()
+		wg.Wait()
+	}()
 
-		pingers = append(pingers, pinger)
+	if waiting == 0 {
+		return errors.New("connection did not come back up, no remote hosts could be probed")
 	}
 
-	for _, pinger := range pingers {
-		wg.Add(1)
-		go func() {
-			pinger.Run()
-			wg.Done()
-		}()
+	tracker := newRecoveryTracker(policy, nil)
+	start := time.Now()
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+
+	for {
+		select {
+		case target := <-started:
+			tracker.add(target)
+		case f := <-failures:
+			// As in a check, a target that cannot be probed must not stop the others
+			level.Warn(logger).Log("remote_host", f.target.Host, "err", f.err, "msg", "failed to probe remote host")
+			tracker.drop(f.target, time.Now())
+			if waiting--; waiting == 0 {
+				return fmt.Errorf("connection did not come back up, no remote hosts could be probed: %w", f.err)
+			}
+		case ev := <-events:
+			if ev.ok {
+				tracker.reply(ev.target, ev.at)
+			} else {
+				tracker.loss(ev.target, ev.at)
+			}
+			if tracker.restored(ev.at) {
+				level.Debug(logger).Log("replies", tracker, "waited", time.Since(start), "msg", "connection restored")
+				return nil
+			}
+		case <-progress.C:
+			level.Info(logger).Log("replies", tracker, "waited", time.Since(start).Round(time.Second), "msg", "waiting for connection to be restored")
+		case <-pingerCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.New("connection did not come back up")
+		}
 	}
+}
 
-	wg.Wait()
+// recoveryPinger creates a pinger for a target, looking it up again every resolveRetry until it resolves or the context
+// is done
+func (pc *PingChecker) recoveryPinger(ctx context.Context, logger log.Logger, target Target) (*Pinger, error) {
+	for {
+		pinger, err := pc.makePinger(ctx, target)
+		var resolveErr *ResolveError
+		if !errors.As(err, &resolveErr) {
+			return pinger, err
+		}
+		level.Debug(logger).Log("remote_host", target.Host, "err", err, "msg", "ping target unresolved")
 
-	if pingsReceived < pingsRequired {
-		return errors.New("connection did not come back up")
+		timer := time.NewTimer(resolveRetry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
-	return nil
 }
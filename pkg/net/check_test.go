@@ -0,0 +1,168 @@
+package net
+
+import (
+	"context"
+	"errors"
+	stdnet "net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("1.1.1.1")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{Host: "1.1.1.1", Weight: 1}, target, "Unweighted targets should default to a weight of 1")
+
+	target, err = ParseTarget("example.com=3")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{Host: "example.com", Weight: 3}, target)
+
+	target, err = ParseTarget("2606:4700:4700::1111=2")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{Host: "2606:4700:4700::1111", Weight: 2}, target, "IPv6 addresses should not be confused with weights")
+
+	target, err = ParseTarget("router-ping:1.1.1.1=2")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{Host: "1.1.1.1", Weight: 2, Router: true}, target, "Should recognise a target pinged by the router")
+	assert.Equal(t, "router-ping:1.1.1.1=2", target.String(), "Should format a target as it was given")
+
+	_, err = ParseTarget("=2")
+	assert.Error(t, err, "Should reject a missing host")
+
+	_, err = ParseTarget("router-ping:")
+	assert.Error(t, err, "Should reject a router-ping target without a host")
+
+	_, err = ParseTarget("1.1.1.1=0")
+	assert.Error(t, err, "Should reject a zero weight")
+
+	_, err = ParseTarget("1.1.1.1=heavy")
+	assert.Error(t, err, "Should reject a non-numeric weight")
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets([]string{"2606:4700:4700::1111", "example.com=2"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{{Host: "2606:4700:4700::1111", Weight: 1, IPv6: true}, {Host: "example.com", Weight: 2, IPv6: true}}, targets)
+
+	_, err = ParseTargets([]string{"1.1.1.1"}, true)
+	assert.Error(t, err, "Should reject an IPv4 address as an IPv6 target")
+
+	_, err = ParseTargets([]string{"2606:4700:4700::1111"}, false)
+	assert.Error(t, err, "Should reject an IPv6 address as an IPv4 target")
+
+	_, err = ParseTargets([]string{"router-ping:example.com"}, true)
+	assert.Error(t, err, "Should reject a router-ping target over IPv6")
+}
+
+func TestProbeFromRouter(t *testing.T) {
+	target := Target{Host: "192.0.2.1", Weight: 1, Router: true}
+
+	checker := NewPingChecker(PingConfig{})
+	assert.Error(t, checker.Probe(context.Background(), target).Err, "Should fail without a way to ping from the router")
+
+	var pinged string
+	checker = NewPingChecker(PingConfig{RouterPing: func(ctx context.Context, host string, count int) (int, int, time.Duration, error) {
+		pinged = host
+		return count, 2, 10 * time.Millisecond, nil
+	}})
+	result := checker.Probe(context.Background(), target)
+	assert.Equal(t, "192.0.2.1", pinged, "The router should ping the target")
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 3, result.Sent)
+	assert.Equal(t, 2, result.Recv)
+	assert.InDelta(t, 33.3, result.Loss, 0.1)
+	assert.Equal(t, 10*time.Millisecond, result.AvgRtt)
+	assert.False(t, result.Failed())
+}
+
+func TestQuorumDown(t *testing.T) {
+	up := func(host string, weight uint) ProbeResult {
+		return ProbeResult{Target: Target{Host: host, Weight: weight}, Sent: 3, Recv: 3}
+	}
+	down := func(host string, weight uint) ProbeResult {
+		return ProbeResult{Target: Target{Host: host, Weight: weight}, Sent: 3, Recv: 0, Loss: 100}
+	}
+
+	all := Quorum{}
+	assert.False(t, all.Down([]ProbeResult{up("a", 1), down("b", 1), down("c", 1)}, false), "Should be up while any target responds")
+	assert.True(t, all.Down([]ProbeResult{down("a", 1), down("b", 1), down("c", 1)}, false), "Should be down when every target fails")
+	assert.False(t, all.Down(nil, false), "Should not declare an outage without any targets")
+
+	twoOfThree := Quorum{FailWeight: 2}
+	assert.False(t, twoOfThree.Down([]ProbeResult{up("a", 1), up("b", 1), down("c", 1)}, false))
+	assert.True(t, twoOfThree.Down([]ProbeResult{up("a", 1), down("b", 1), down("c", 1)}, false))
+
+	weighted := Quorum{FailWeight: 3}
+	assert.False(t, weighted.Down([]ProbeResult{down("a", 1), down("b", 1), up("c", 3)}, false))
+	assert.True(t, weighted.Down([]ProbeResult{up("a", 1), up("b", 1), down("c", 3)}, false), "A heavily weighted target should meet the quorum alone")
+
+	excessive := Quorum{FailWeight: 10}
+	assert.True(t, excessive.Down([]ProbeResult{down("a", 1), down("b", 1)}, false), "A quorum above the total weight should require all targets to fail")
+
+	v6 := down("2001:db8::1", 1)
+	v6.Target.IPv6 = true
+	assert.False(t, all.Down([]ProbeResult{up("a", 1), v6}, false), "IPv6 failures should not count towards the IPv4 quorum")
+	assert.True(t, all.Down([]ProbeResult{up("a", 1), v6}, true))
+
+	errored := ProbeResult{Target: Target{Host: "a", Weight: 1}, Err: errors.New("failed")}
+	assert.True(t, all.Down([]ProbeResult{errored}, false), "Errored probes should count as failures")
+}
+
+func TestCheckResultAverage(t *testing.T) {
+	cr := CheckResult{Results: []ProbeResult{
+		{Target: Target{Host: "a"}, Sent: 4, Recv: 4, AvgRtt: 10 * time.Millisecond},
+		{Target: Target{Host: "b"}, Sent: 4, Recv: 2, Loss: 50, AvgRtt: 30 * time.Millisecond},
+		{Target: Target{Host: "c"}, Sent: 4, Recv: 0, Loss: 100},
+		{Target: Target{Host: "d"}, Err: errors.New("failed")},
+	}}
+	rtt, loss := cr.Average()
+	assert.Equal(t, 20*time.Millisecond, rtt, "Should average the round trip time of targets that replied")
+	assert.Equal(t, 50.0, loss, "Should average the loss of targets that could be probed")
+
+	rtt, loss = CheckResult{}.Average()
+	assert.Zero(t, rtt)
+	assert.Zero(t, loss)
+}
+
+func TestUnprobed(t *testing.T) {
+	ok := ProbeResult{Target: Target{Host: "a"}, Sent: 3, Recv: 3}
+	bindErr := ProbeResult{Target: Target{Host: "b"}, Err: errors.New("bind address 192.0.2.1 cannot reach 198.51.100.1")}
+	unresolved := ProbeResult{Target: Target{Host: "c"}, Err: &ResolveError{Host: "c", Err: errors.New("no such host")}}
+	v6Err := ProbeResult{Target: Target{Host: "2001:db8::1", IPv6: true}, Err: errors.New("address family not supported")}
+
+	assert.NoError(t, unprobed([]ProbeResult{ok, bindErr, v6Err}, false), "A target that could be probed should let the check run")
+	assert.NoError(t, unprobed([]ProbeResult{unresolved, bindErr}, false), "An unresolved target is an outage, not a local fault")
+	assert.Error(t, unprobed([]ProbeResult{bindErr, v6Err}, false), "Should fail when no IPv4 target could be probed")
+	assert.Error(t, unprobed([]ProbeResult{ok, v6Err}, true), "Should fail when no IPv6 target could be probed")
+	assert.NoError(t, unprobed([]ProbeResult{ok}, true), "A family without targets is not a fault")
+}
+
+func TestWaitForRecovery(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	// A target that does not resolve yet should be looked up again for the whole wait, not fail it straight away
+	resolver := &fakeResolver{err: errors.New("server misbehaving")}
+	checker := NewPingChecker(PingConfig{
+		Targets:  []Target{{Host: "example.com", Weight: 1}},
+		Resolver: resolver,
+	})
+	start := time.Now()
+	err := checker.WaitForRecovery(ctx, logger, RecoveryPolicy{MaxWait: 1500 * time.Millisecond})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) >= 1500*time.Millisecond, "Should wait for the target to resolve until the maximum wait")
+	assert.True(t, resolver.lookups >= 2, "Should look the target up again while waiting")
+
+	// Targets that can never be probed should fail the wait without waiting
+	bound := NewPingChecker(PingConfig{
+		Targets: []Target{{Host: "2001:db8::1", Weight: 1, IPv6: true}},
+		Binding: Binding{Address: stdnet.ParseIP("192.0.2.1")},
+	})
+	start = time.Now()
+	err = bound.WaitForRecovery(ctx, logger, RecoveryPolicy{MaxWait: time.Minute})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Minute, "Should fail once no target can be probed")
+}
@@ -0,0 +1,172 @@
+package net
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DegradationRules describe when a connection that is up should still be treated as degraded.
+// A zero threshold disables the corresponding rule.
+type DegradationRules struct {
+	Window       int           // The number of checks over which loss, latency and jitter are measured
+	MaxLoss      float64       // The packet loss percentage above which the connection is degraded
+	MaxMedianRtt time.Duration // The median round trip time above which the connection is degraded
+	MaxJitter    time.Duration // The mean variation between consecutive round trips above which the connection is degraded
+	Consecutive  int           // The number of consecutive checks that must breach a rule before the connection is degraded
+}
+
+// Enabled returns true if any rule has been configured
+func (r DegradationRules) Enabled() bool {
+	return r.MaxLoss > 0 || r.MaxMedianRtt > 0 || r.MaxJitter > 0
+}
+
+// Degradation describes the quality of the connection over the rolling window
+type Degradation struct {
+	Degraded  bool
+	Breaches  int // The number of consecutive checks that have breached a rule
+	Loss      float64
+	MedianRtt time.Duration
+	Jitter    time.Duration
+	Reasons   []string
+}
+
+// History keeps a rolling window of check results to evaluate degradation rules against
+type History struct {
+	rules    DegradationRules
+	checks   []CheckResult
+	breaches int
+}
+
+func NewHistory(rules DegradationRules) *History {
+	if rules.Window < 1 {
+		rules.Window = 1
+	}
+	if rules.Consecutive < 1 {
+		rules.Consecutive = 1
+	}
+	return &History{rules: rules}
+}
+
+// Reset discards all recorded checks, e.g. after the connection has been re-established
+func (h *History) Reset() {
+	h.checks = nil
+	h.breaches = 0
+}
+
+// Observe records the result of a check and evaluates the rules over the window
+func (h *History) Observe(result CheckResult) Degradation {
+	h.checks = append(h.checks, result)
+	if len(h.checks) > h.rules.Window {
+		h.checks = h.checks[len(h.checks)-h.rules.Window:]
+	}
+
+	d := h.measure()
+	if h.rules.MaxLoss > 0 && d.Loss > h.rules.MaxLoss {
+		d.Reasons = append(d.Reasons, fmt.Sprintf("loss %.1f%% above %.1f%%", d.Loss, h.rules.MaxLoss))
+	}
+	if h.rules.MaxMedianRtt > 0 && d.MedianRtt > h.rules.MaxMedianRtt {
+		d.Reasons = append(d.Reasons, fmt.Sprintf("median rtt %s above %s", d.MedianRtt, h.rules.MaxMedianRtt))
+	}
+	if h.rules.MaxJitter > 0 && d.Jitter > h.rules.MaxJitter {
+		d.Reasons = append(d.Reasons, fmt.Sprintf("jitter %s above %s", d.Jitter, h.rules.MaxJitter))
+	}
+
+	if len(d.Reasons) > 0 {
+		h.breaches++
+	} else {
+		h.breaches = 0
+	}
+	d.Breaches = h.breaches
+	d.Degraded = h.breaches >= h.rules.Consecutive
+	return d
+}
+
+// measure finds the loss, median RTT and jitter of each target across the window, and reports the best target's
+// figures. A single distant or failing target should not make the whole connection look degraded.
+func (h *History) measure() Degradation {
+	type targetWindow struct {
+		sent, recv int
+		rtts       []time.Duration
+	}
+
+	var order []string
+	windows := make(map[string]*targetWindow)
+	for _, check := range h.checks {
+		for _, r := range check.Results {
+			w, ok := windows[r.Target.Host]
+			if !ok {
+				w = &targetWindow{}
+				windows[r.Target.Host] = w
+				order = append(order, r.Target.Host)
+			}
+			// Probes that could not be sent say nothing about the quality of the line
+			if r.Err != nil || r.Sent == 0 {
+				continue
+			}
+			w.sent += r.Sent
+			w.recv += r.Recv
+			w.rtts = append(w.rtts, r.Rtts...)
+		}
+	}
+
+	var best Degradation
+	haveLoss, haveRtt := false, false
+	for _, host := range order {
+		w := windows[host]
+		if w.sent == 0 {
+			continue
+		}
+
+		loss := float64(w.sent-w.recv) / float64(w.sent) * 100
+		if !haveLoss || loss < best.Loss {
+			best.Loss = loss
+			haveLoss = true
+		}
+
+		// A target that never replied has no latency to compare, its loss is enough
+		if len(w.rtts) == 0 {
+			continue
+		}
+		medianRtt, jitterRtt := median(w.rtts), jitter(w.rtts)
+		if !haveRtt || medianRtt < best.MedianRtt {
+			best.MedianRtt = medianRtt
+		}
+		if !haveRtt || jitterRtt < best.Jitter {
+			best.Jitter = jitterRtt
+		}
+		haveRtt = true
+	}
+	return best
+}
+
+func median(rtts []time.Duration) time.Duration {
+	if len(rtts) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// jitter is the mean absolute difference between consecutive round trip times
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
+	var total time.Duration
+	for i := 1; i < len(rtts); i++ {
+		diff := rtts[i] - rtts[i-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		total += diff
+	}
+	return total / time.Duration(len(rtts)-1)
+}
@@ -0,0 +1,65 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probeResult(host string, sent int, rtts ...time.Duration) ProbeResult {
+	return ProbeResult{
+		Target: Target{Host: host, Weight: 1},
+		Sent:   sent,
+		Recv:   len(rtts),
+		Loss:   float64(sent-len(rtts)) / float64(sent) * 100,
+		Rtts:   rtts,
+	}
+}
+
+func TestHistoryLoss(t *testing.T) {
+	h := NewHistory(DegradationRules{Window: 2, MaxLoss: 30, Consecutive: 2})
+	ms := time.Millisecond
+
+	d := h.Observe(CheckResult{Up: true, Results: []ProbeResult{probeResult("a", 3, 10*ms)}})
+	assert.InDelta(t, 66.7, d.Loss, 0.1)
+	assert.Equal(t, 1, d.Breaches)
+	assert.False(t, d.Degraded, "Should not be degraded until enough consecutive checks breach a rule")
+
+	d = h.Observe(CheckResult{Up: true, Results: []ProbeResult{probeResult("a", 3, 10*ms, 10*ms)}})
+	assert.InDelta(t, 50, d.Loss, 0.1, "Loss should be measured across the window")
+	assert.True(t, d.Degraded)
+	assert.Len(t, d.Reasons, 1)
+
+	h.Observe(CheckResult{Up: true, Results: []ProbeResult{probeResult("a", 3, 10*ms, 10*ms, 10*ms)}})
+	d = h.Observe(CheckResult{Up: true, Results: []ProbeResult{probeResult("a", 3, 10*ms, 10*ms, 10*ms)}})
+	assert.Equal(t, 0.0, d.Loss, "Old checks should leave the window")
+	assert.False(t, d.Degraded)
+	assert.Equal(t, 0, d.Breaches)
+}
+
+func TestHistoryLatency(t *testing.T) {
+	h := NewHistory(DegradationRules{Window: 5, MaxMedianRtt: 500 * time.Millisecond, MaxJitter: 100 * time.Millisecond})
+	ms := time.Millisecond
+
+	// A slow, dead or flaky target should not mask a healthy one
+	d := h.Observe(CheckResult{Up: true, Results: []ProbeResult{
+		probeResult("slow", 3, 800*ms, 900*ms, 1000*ms),
+		probeResult("dead", 3),
+		probeResult("ok", 3, 20*ms, 22*ms, 21*ms),
+	}})
+	assert.Equal(t, 0.0, d.Loss)
+	assert.Equal(t, 21*ms, d.MedianRtt)
+	assert.Equal(t, 1500*time.Microsecond, d.Jitter)
+	assert.False(t, d.Degraded)
+
+	h.Reset()
+	d = h.Observe(CheckResult{Up: true, Results: []ProbeResult{
+		probeResult("a", 3, 800*ms, 200*ms, 900*ms),
+		probeResult("b", 3),
+	}})
+	assert.Equal(t, 800*ms, d.MedianRtt)
+	assert.Equal(t, 650*ms, d.Jitter)
+	assert.True(t, d.Degraded)
+	assert.Len(t, d.Reasons, 2)
+}
@@ -0,0 +1,155 @@
+package net
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthPolicy controls when a target that keeps failing while others succeed is demoted. Demoted targets are not
+// probed or counted towards the quorum until the demotion expires, so a dead target cannot skew the outage decision.
+type HealthPolicy struct {
+	DemoteAfter int           // The number of consecutive lone failures before demotion, or 0 to never demote
+	DemoteFor   time.Duration // How long a target stays demoted before it is probed again
+}
+
+// TargetHealth summarises the recent history of a target
+type TargetHealth struct {
+	Target       Target
+	Successes    int       // The total number of successful probes
+	Failures     int       // The total number of failed probes
+	LoneFailures int       // The number of consecutive probes that failed while another target succeeded
+	LastSuccess  time.Time // Zero if the target has never responded
+	DemotedUntil time.Time
+}
+
+// Demoted returns true if the target is currently excluded from checks
+func (h TargetHealth) Demoted(now time.Time) bool {
+	return now.Before(h.DemotedUntil)
+}
+
+func (h TargetHealth) String() string {
+	state := "ok"
+	if h.Demoted(time.Now()) {
+		state = "demoted"
+	} else if h.LoneFailures > 0 {
+		state = "suspect"
+	}
+	return fmt.Sprintf("%s:%s:%d/%d", h.Target.Host, state, h.Successes, h.Successes+h.Failures)
+}
+
+// FormatHealth formats the health of each target for logging
+func FormatHealth(health []TargetHealth) string {
+	parts := make([]string, len(health))
+	for i, h := range health {
+		parts[i] = h.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// healthTracker records the success history of each target
+type healthTracker struct {
+	policy HealthPolicy
+
+	mu      sync.Mutex
+	targets map[string]*TargetHealth
+	order   []string
+}
+
+func newHealthTracker(policy HealthPolicy, targets []Target) *healthTracker {
+	ht := &healthTracker{
+		policy:  policy,
+		targets: make(map[string]*TargetHealth, len(targets)),
+	}
+	for _, t := range targets {
+		key := targetKey(t)
+		ht.targets[key] = &TargetHealth{Target: t}
+		ht.order = append(ht.order, key)
+	}
+	return ht
+}
+
+func targetKey(t Target) string {
+	if t.IPv6 {
+		return "ipv6/" + t.Host
+	}
+	return t.Host
+}
+
+// active returns the targets that should be probed. If every target of an IP version is demoted, they are all probed
+// regardless, as there would otherwise be nothing to decide the outage with.
+func (ht *healthTracker) active(targets []Target, now time.Time) []Target {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	var active, demoted []Target
+	activeFamilies := make(map[bool]bool)
+	for _, t := range targets {
+		if h, ok := ht.targets[targetKey(t)]; ok && h.Demoted(now) {
+			demoted = append(demoted, t)
+			continue
+		}
+		active = append(active, t)
+		activeFamilies[t.IPv6] = true
+	}
+
+	for _, t := range demoted {
+		if !activeFamilies[t.IPv6] {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// record updates the history of each probed target, returning any targets that were newly demoted
+func (ht *healthTracker) record(results []ProbeResult, now time.Time) []TargetHealth {
+	succeeded := make(map[bool]bool)
+	for _, r := range results {
+		if !r.Failed() {
+			succeeded[r.Target.IPv6] = true
+		}
+	}
+
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	var demoted []TargetHealth
+	for _, r := range results {
+		h, ok := ht.targets[targetKey(r.Target)]
+		if !ok {
+			continue
+		}
+
+		if !r.Failed() {
+			h.Successes++
+			h.LastSuccess = now
+			h.LoneFailures = 0
+			h.DemotedUntil = time.Time{}
+			continue
+		}
+
+		h.Failures++
+		// Failures while every target is failing are an outage, not a problem with this target
+		if !succeeded[r.Target.IPv6] {
+			continue
+		}
+		h.LoneFailures++
+		if ht.policy.DemoteAfter > 0 && h.LoneFailures >= ht.policy.DemoteAfter {
+			h.DemotedUntil = now.Add(ht.policy.DemoteFor)
+			demoted = append(demoted, *h)
+		}
+	}
+	return demoted
+}
+
+func (ht *healthTracker) health() []TargetHealth {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	health := make([]TargetHealth, len(ht.order))
+	for i, key := range ht.order {
+		health[i] = *ht.targets[key]
+	}
+	return health
+}
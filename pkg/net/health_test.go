@@ -0,0 +1,47 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthTracker(t *testing.T) {
+	a := Target{Host: "a", Weight: 1}
+	b := Target{Host: "b", Weight: 1}
+	c := Target{Host: "c", Weight: 1, IPv6: true}
+	targets := []Target{a, b, c}
+	ht := newHealthTracker(HealthPolicy{DemoteAfter: 2, DemoteFor: time.Minute}, targets)
+
+	ok := func(t Target) ProbeResult { return ProbeResult{Target: t, Sent: 3, Recv: 3} }
+	fail := func(t Target) ProbeResult { return ProbeResult{Target: t, Sent: 3, Loss: 100} }
+	now := time.Now()
+
+	// Failures during an outage should not count against a target
+	assert.Empty(t, ht.record([]ProbeResult{fail(a), fail(b), ok(c)}, now))
+	assert.Equal(t, 0, ht.health()[0].LoneFailures, "IPv6 successes should not make an IPv4 failure lone")
+
+	assert.Empty(t, ht.record([]ProbeResult{ok(a), fail(b), ok(c)}, now))
+	demoted := ht.record([]ProbeResult{ok(a), fail(b), ok(c)}, now)
+	assert.Len(t, demoted, 1)
+	assert.Equal(t, "b", demoted[0].Target.Host)
+	assert.Equal(t, []Target{a, c}, ht.active(targets, now), "Demoted targets should not be probed")
+
+	health := ht.health()
+	assert.Equal(t, 3, health[1].Failures)
+	assert.Equal(t, 2, health[1].LoneFailures)
+	assert.True(t, health[1].LastSuccess.IsZero())
+
+	// While every other IPv4 target is demoted, the demoted targets must still be probed
+	ht.record([]ProbeResult{fail(a), ok(c)}, now)
+	ht.targets["a"].DemotedUntil = now.Add(time.Minute)
+	assert.ElementsMatch(t, targets, ht.active(targets, now))
+
+	// Once the demotion expires, the target is probed again, and a success restores it
+	later := now.Add(2 * time.Minute)
+	assert.Equal(t, targets, ht.active(targets, later))
+	assert.Empty(t, ht.record([]ProbeResult{ok(a), ok(b), ok(c)}, later))
+	assert.Equal(t, 0, ht.health()[1].LoneFailures)
+	assert.Equal(t, later, ht.health()[1].LastSuccess)
+}
@@ -0,0 +1,296 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	stdnet "net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+	trackerLength    = 8
+)
+
+// socketOptions are applied to ICMP sockets before they are used
+type socketOptions struct {
+	source       string // The local address to bind to
+	iface        string // The interface to bind to
+	dontFragment bool   // Whether to set the DF flag on outgoing packets
+}
+
+// Reply describes an echo reply received by a Pinger
+type Reply struct {
+	Seq  int
+	Rtt  time.Duration
+	Size int
+}
+
+// Statistics summarise the echo requests sent by a Pinger
+type Statistics struct {
+	Sent    int
+	Recv    int
+	Rtts    []time.Duration
+	SendErr error // The last error encountered when sending, which usually means the destination is unreachable
+}
+
+// Loss returns the percentage of echo requests that were not answered
+func (s Statistics) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Recv) / float64(s.Sent) * 100
+}
+
+// AvgRtt returns the mean round trip time of the answered echo requests
+func (s Statistics) AvgRtt() time.Duration {
+	if len(s.Rtts) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, rtt := range s.Rtts {
+		total += rtt
+	}
+	return total / time.Duration(len(s.Rtts))
+}
+
+// Pinger sends a series of ICMP echo requests to a single address. Each request is considered lost if no reply
+// arrives within Timeout of it being sent, so a run always completes within (Count-1)*Interval + Timeout.
+type Pinger struct {
+	Addr      *stdnet.IPAddr
+	Source    string // The local address to send from, if set
+	Interface string // The interface to bind the socket to, if set
+	RawSocket bool   // Use a raw socket rather than an unprivileged datagram socket
+	Count     int
+	Interval  time.Duration
+	Timeout   time.Duration
+	Size      int // The size of the echo payload, including the tracker
+	// DontFragment sets the DF flag, so requests larger than the path MTU are dropped rather than fragmented
+	DontFragment bool
+	OnRecv       func(Reply)
+	OnLoss       func(seq int) // Called when a request times out or could not be sent
+
+	listen func(ctx context.Context) (stdnet.PacketConn, error) // Overrides the socket, for testing
+}
+
+// NewPinger creates a pinger for addr with defaults of 3 requests, 1 second apart, each with a 2 second timeout
+func NewPinger(addr *stdnet.IPAddr) *Pinger {
+	return &Pinger{
+		Addr:     addr,
+		Count:    3,
+		Interval: time.Second,
+		Timeout:  2 * time.Second,
+		Size:     trackerLength,
+	}
+}
+
+func (p *Pinger) rawSocket() bool {
+	return p.RawSocket || rawSocketRequired
+}
+
+func (p *Pinger) isIPv4() bool {
+	return p.Addr.IP.To4() != nil
+}
+
+type receivedEcho struct {
+	seq  int
+	at   time.Time
+	size int
+}
+
+// Run sends the echo requests and waits for the replies, returning early if the context is cancelled. An error is
+// only returned if the socket could not be opened, failures to send are counted as lost requests.
+func (p *Pinger) Run(ctx context.Context) (Statistics, error) {
+	if p.Count < 1 {
+		return Statistics{}, errors.New("ping count must be at least 1")
+	}
+
+	listen := p.listen
+	if listen == nil {
+		listen = func(ctx context.Context) (stdnet.PacketConn, error) {
+			return listenICMP(ctx, p.isIPv4(), p.rawSocket(), socketOptions{
+				source:       p.Source,
+				iface:        p.Interface,
+				dontFragment: p.DontFragment,
+			})
+		}
+	}
+	conn, err := listen(ctx)
+	if err != nil {
+		return Statistics{}, err
+	}
+	defer conn.Close()
+
+	id, err := randomInt(math.MaxUint16)
+	if err != nil {
+		return Statistics{}, err
+	}
+	tracker := make([]byte, trackerLength)
+	if _, err := rand.Read(tracker); err != nil {
+		return Statistics{}, err
+	}
+
+	replies := make(chan receivedEcho)
+	done := make(chan struct{})
+	defer close(done)
+	go p.receive(conn, id, tracker, replies, done)
+
+	var stats Statistics
+	sentAt := make(map[int]time.Time, p.Count)
+	nextSend := time.Now()
+
+	for {
+		now := time.Now()
+
+		// Expire any outstanding requests that have passed their timeout
+		for seq, at := range sentAt {
+			if now.Sub(at) >= p.Timeout {
+				delete(sentAt, seq)
+				p.lost(seq)
+			}
+		}
+
+		if stats.Sent < p.Count && !now.Before(nextSend) {
+			seq := stats.Sent
+			stats.Sent++
+			if err := p.send(conn, id, seq, tracker); err != nil {
+				stats.SendErr = err
+				p.lost(seq)
+			} else {
+				sentAt[seq] = now
+			}
+			nextSend = now.Add(p.Interval)
+		}
+
+		if stats.Sent >= p.Count && len(sentAt) == 0 {
+			return stats, nil
+		}
+
+		// Wake for the next send, or the earliest timeout of an outstanding request
+		var wake time.Time
+		if stats.Sent < p.Count {
+			wake = nextSend
+		}
+		for _, at := range sentAt {
+			if expiry := at.Add(p.Timeout); wake.IsZero() || expiry.Before(wake) {
+				wake = expiry
+			}
+		}
+		timer := time.NewTimer(time.Until(wake))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stats, nil
+		case <-timer.C:
+		case echo := <-replies:
+			timer.Stop()
+			at, ok := sentAt[echo.seq]
+			if !ok {
+				// Duplicate or late replies are ignored
+				continue
+			}
+			delete(sentAt, echo.seq)
+			reply := Reply{Seq: echo.seq, Rtt: echo.at.Sub(at), Size: echo.size}
+			if reply.Rtt > p.Timeout {
+				p.lost(echo.seq)
+				continue
+			}
+			stats.Recv++
+			stats.Rtts = append(stats.Rtts, reply.Rtt)
+			if p.OnRecv != nil {
+				p.OnRecv(reply)
+			}
+		}
+	}
+}
+
+func (p *Pinger) lost(seq int) {
+	if p.OnLoss != nil {
+		p.OnLoss(seq)
+	}
+}
+
+func (p *Pinger) send(conn stdnet.PacketConn, id, seq int, tracker []byte) error {
+	payload := make([]byte, trackerLength)
+	if p.Size > trackerLength {
+		payload = make([]byte, p.Size)
+	}
+	copy(payload, tracker)
+
+	msg := icmp.Message{
+		Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: payload},
+	}
+	if p.isIPv4() {
+		msg.Type = ipv4.ICMPTypeEcho
+	} else {
+		msg.Type = ipv6.ICMPTypeEchoRequest
+	}
+
+	// The kernel fills in the ICMPv6 checksum, so no pseudo header is required
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	var dst stdnet.Addr = p.Addr
+	if !p.rawSocket() {
+		dst = &stdnet.UDPAddr{IP: p.Addr.IP, Zone: p.Addr.Zone}
+	}
+	_, err = conn.WriteTo(b, dst)
+	return err
+}
+
+// receive reads replies from the socket until it is closed, forwarding any that match our requests
+func (p *Pinger) receive(conn stdnet.PacketConn, id int, tracker []byte, replies chan<- receivedEcho, done <-chan struct{}) {
+	proto, replyType := protocolICMP, icmp.Type(ipv4.ICMPTypeEchoReply)
+	if !p.isIPv4() {
+		proto, replyType = protocolIPv6ICMP, ipv6.ICMPTypeEchoReply
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		at := time.Now()
+
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || msg.Type != replyType {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || !bytes.HasPrefix(echo.Data, tracker) {
+			continue
+		}
+		// Datagram sockets have their identifier rewritten by the kernel, which also filters replies for us
+		if p.rawSocket() && echo.ID != id {
+			continue
+		}
+
+		select {
+		case replies <- receivedEcho{seq: echo.Seq, at: at, size: len(echo.Data)}:
+		case <-done:
+			return
+		}
+	}
+}
+
+func randomInt(max int64) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
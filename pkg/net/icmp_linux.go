@@ -0,0 +1,85 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	stdnet "net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const rawSocketRequired = false
+
+// On Linux, unprivileged datagram sockets are only available to groups in net.ipv4.ping_group_range, and raw
+// sockets require CAP_NET_RAW, so the user must choose which to use
+func listenICMP(_ context.Context, ipv4, rawSocket bool, opts socketOptions) (stdnet.PacketConn, error) {
+	family, proto := unix.AF_INET, protocolICMP
+	if !ipv4 {
+		family, proto = unix.AF_INET6, protocolIPv6ICMP
+	}
+	sockType := unix.SOCK_DGRAM
+	if rawSocket {
+		sockType = unix.SOCK_RAW
+	}
+
+	fd, err := unix.Socket(family, sockType|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	if err := setupICMPSocket(fd, family, opts); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return stdnet.FilePacketConn(f)
+}
+
+func setupICMPSocket(fd, family int, opts socketOptions) error {
+	if opts.iface != "" {
+		if err := unix.BindToDevice(fd, opts.iface); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+
+	if opts.dontFragment {
+		var err error
+		if family == unix.AF_INET {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+		} else {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, 1)
+		}
+		if err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+
+	source := opts.source
+
+	var sa unix.Sockaddr
+	if family == unix.AF_INET {
+		sa4 := &unix.SockaddrInet4{}
+		if source != "" {
+			ip := stdnet.ParseIP(source).To4()
+			if ip == nil {
+				return fmt.Errorf("invalid IPv4 source address %q", source)
+			}
+			copy(sa4.Addr[:], ip)
+		}
+		sa = sa4
+	} else {
+		sa6 := &unix.SockaddrInet6{}
+		if source != "" {
+			ip := stdnet.ParseIP(source).To16()
+			if ip == nil {
+				return fmt.Errorf("invalid IPv6 source address %q", source)
+			}
+			copy(sa6.Addr[:], ip)
+		}
+		sa = sa6
+	}
+	return os.NewSyscallError("bind", unix.Bind(fd, sa))
+}
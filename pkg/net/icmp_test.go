@@ -0,0 +1,163 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// fakeICMPConn answers IPv4 echo requests according to respond, which returns the delays at which to send each
+// copy of the reply for a sequence number
+type fakeICMPConn struct {
+	respond func(seq int) []time.Duration
+
+	replies   chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeICMPConn(respond func(seq int) []time.Duration) *fakeICMPConn {
+	return &fakeICMPConn{
+		respond: respond,
+		replies: make(chan []byte, 16),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *fakeICMPConn) WriteTo(b []byte, addr stdnet.Addr) (int, error) {
+	msg, err := icmp.ParseMessage(protocolICMP, b)
+	if err != nil {
+		return 0, err
+	}
+	echo := msg.Body.(*icmp.Echo)
+	reply, err := (&icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: echo}).Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delay := range c.respond(echo.Seq) {
+		time.AfterFunc(delay, func() {
+			select {
+			case c.replies <- reply:
+			case <-c.closed:
+			}
+		})
+	}
+	return len(b), nil
+}
+
+func (c *fakeICMPConn) ReadFrom(b []byte) (int, stdnet.Addr, error) {
+	select {
+	case reply := <-c.replies:
+		return copy(b, reply), &stdnet.UDPAddr{IP: stdnet.IPv4(192, 0, 2, 1)}, nil
+	case <-c.closed:
+		return 0, nil, errors.New("closed")
+	}
+}
+
+func (c *fakeICMPConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeICMPConn) LocalAddr() stdnet.Addr             { return &stdnet.UDPAddr{} }
+func (c *fakeICMPConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeICMPConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeICMPConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func fakePinger(respond func(seq int) []time.Duration) *Pinger {
+	p := NewPinger(&stdnet.IPAddr{IP: stdnet.IPv4(192, 0, 2, 1)})
+	p.Interval = 20 * time.Millisecond
+	p.Timeout = 100 * time.Millisecond
+	p.listen = func(ctx context.Context) (stdnet.PacketConn, error) {
+		return newFakeICMPConn(respond), nil
+	}
+	return p
+}
+
+func TestPingerSequenceTracking(t *testing.T) {
+	// Every reply is duplicated, and the second request is answered too late
+	p := fakePinger(func(seq int) []time.Duration {
+		if seq == 1 {
+			return []time.Duration{150 * time.Millisecond}
+		}
+		return []time.Duration{time.Millisecond, 2 * time.Millisecond}
+	})
+
+	var seqs []int
+	p.OnRecv = func(r Reply) {
+		seqs = append(seqs, r.Seq)
+	}
+
+	stats, err := p.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Sent)
+	assert.Equal(t, 2, stats.Recv, "Duplicate and late replies should not be counted")
+	assert.InDelta(t, 33.3, stats.Loss(), 0.1)
+	assert.Equal(t, []int{0, 2}, seqs)
+}
+
+func TestPingerTimeout(t *testing.T) {
+	p := fakePinger(func(seq int) []time.Duration { return nil })
+
+	start := time.Now()
+	stats, err := p.Run(context.Background())
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Sent)
+	assert.Equal(t, 0, stats.Recv)
+	assert.Equal(t, 100.0, stats.Loss())
+	assert.True(t, elapsed >= 2*p.Interval+p.Timeout, "Run should wait for the last request to time out, took %s", elapsed)
+	assert.True(t, elapsed < 2*p.Interval+p.Timeout+100*time.Millisecond, "Run should finish once the last request times out, took %s", elapsed)
+}
+
+func TestPingerCancel(t *testing.T) {
+	p := fakePinger(func(seq int) []time.Duration { return nil })
+	p.Timeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.Run(ctx)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second, "Run should return promptly once cancelled")
+}
+
+func TestPingerLoopback(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		for _, raw := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/raw=%v", addr, raw), func(t *testing.T) {
+				p := NewPinger(&stdnet.IPAddr{IP: stdnet.ParseIP(addr)})
+				p.RawSocket = raw
+				p.Interval = 10 * time.Millisecond
+
+				var seqs []int
+				p.OnRecv = func(r Reply) {
+					seqs = append(seqs, r.Seq)
+				}
+
+				stats, err := p.Run(context.Background())
+				if errors.Is(err, os.ErrPermission) {
+					// Datagram sockets need net.ipv4.ping_group_range, and raw sockets need CAP_NET_RAW
+					t.Skipf("ICMP socket not permitted: %v", err)
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, 3, stats.Sent)
+				assert.Equal(t, 3, stats.Recv, "Every echo to loopback should be answered")
+				assert.Len(t, stats.Rtts, 3)
+				assert.Equal(t, []int{0, 1, 2}, seqs, "Each sequence number should be seen exactly once")
+			})
+		}
+	}
+}
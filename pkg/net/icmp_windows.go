@@ -0,0 +1,45 @@
+package net
+
+import (
+	"context"
+	"errors"
+	stdnet "net"
+	"syscall"
+)
+
+// On Windows platforms, we can always use raw ICMP
+const rawSocketRequired = true
+
+// Socket options missing from the syscall package
+const (
+	ipDontFragment = 14
+	ipv6DontFrag   = 14
+)
+
+func listenICMP(ctx context.Context, ipv4, _ bool, opts socketOptions) (stdnet.PacketConn, error) {
+	if opts.iface != "" {
+		return nil, errors.New("binding to an interface is not supported on Windows")
+	}
+
+	network := "ip4:icmp"
+	if !ipv4 {
+		network = "ip6:ipv6-icmp"
+	}
+	var lc stdnet.ListenConfig
+	if opts.dontFragment {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				if ipv4 {
+					sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipDontFragment, 1)
+				} else {
+					sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6DontFrag, 1)
+				}
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.ListenPacket(ctx, network, opts.source)
+}
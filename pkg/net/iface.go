@@ -0,0 +1,34 @@
+package net
+
+import (
+	"fmt"
+	stdnet "net"
+)
+
+// InterfaceFor returns the local interface that traffic to host is routed through. No packets are sent to host.
+func InterfaceFor(host string) (*stdnet.Interface, error) {
+	// Connecting a UDP socket only selects the route and source address
+	conn, err := stdnet.Dial("udp", stdnet.JoinHostPort(host, "9"))
+	if err != nil {
+		return nil, err
+	}
+	local := conn.LocalAddr().(*stdnet.UDPAddr).IP
+	conn.Close()
+
+	ifaces, err := stdnet.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*stdnet.IPNet); ok && ipNet.IP.Equal(local) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no interface has the source address %s", local)
+}
@@ -0,0 +1,14 @@
+package net
+
+// LinkState describes whether a local interface has a working link
+type LinkState struct {
+	Interface string
+	OperState string // The operational state reported by the OS, e.g. "up", "down" or "unknown"
+	Carrier   bool   // Whether the interface has a physical link
+}
+
+// Up returns true if the interface is able to pass traffic
+func (s LinkState) Up() bool {
+	// Virtual interfaces often report an unknown state, but do report their carrier
+	return s.Carrier && (s.OperState == "up" || s.OperState == "unknown")
+}
@@ -0,0 +1,36 @@
+package net
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var sysClassNet = "/sys/class/net"
+
+// ReadLinkState reads the link state of the named interface from sysfs
+func ReadLinkState(iface string) (LinkState, error) {
+	state := LinkState{Interface: iface}
+	dir := filepath.Join(sysClassNet, iface)
+
+	operState, err := ioutil.ReadFile(filepath.Join(dir, "operstate"))
+	if err != nil {
+		return state, err
+	}
+	state.OperState = strings.TrimSpace(string(operState))
+
+	carrier, err := ioutil.ReadFile(filepath.Join(dir, "carrier"))
+	// The carrier cannot be read while the interface is administratively down
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	state.Carrier = strings.TrimSpace(string(carrier)) == "1"
+
+	return state, nil
+}
@@ -0,0 +1,56 @@
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLinkState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysclassnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldSysClassNet := sysClassNet
+	sysClassNet = dir
+	defer func() { sysClassNet = oldSysClassNet }()
+
+	writeIface := func(name, operState, carrier string) {
+		ifaceDir := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(ifaceDir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(ifaceDir, "operstate"), []byte(operState+"\n"), 0644))
+		if carrier != "" {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(ifaceDir, "carrier"), []byte(carrier+"\n"), 0644))
+		}
+	}
+
+	writeIface("eth0", "up", "1")
+	writeIface("eth1", "down", "0")
+	writeIface("eth2", "down", "")
+	writeIface("lo", "unknown", "1")
+
+	state, err := ReadLinkState("eth0")
+	assert.NoError(t, err)
+	assert.Equal(t, LinkState{Interface: "eth0", OperState: "up", Carrier: true}, state)
+	assert.True(t, state.Up())
+
+	state, err = ReadLinkState("eth1")
+	assert.NoError(t, err)
+	assert.False(t, state.Up(), "An unplugged interface should be down")
+
+	state, err = ReadLinkState("eth2")
+	assert.NoError(t, err)
+	assert.False(t, state.Up(), "An administratively down interface should be down")
+
+	state, err = ReadLinkState("lo")
+	assert.NoError(t, err)
+	assert.True(t, state.Up(), "An interface in an unknown state with a carrier should be up")
+
+	_, err = ReadLinkState("eth3")
+	assert.Error(t, err, "Should fail for a missing interface")
+}
@@ -0,0 +1,18 @@
+package net
+
+import stdnet "net"
+
+// Windows does not expose the carrier separately, so the interface flags are used instead
+func ReadLinkState(iface string) (LinkState, error) {
+	state := LinkState{Interface: iface, OperState: "down"}
+
+	i, err := stdnet.InterfaceByName(iface)
+	if err != nil {
+		return state, err
+	}
+	if i.Flags&stdnet.FlagUp != 0 {
+		state.OperState = "up"
+		state.Carrier = true
+	}
+	return state, nil
+}
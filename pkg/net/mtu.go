@@ -0,0 +1,88 @@
+package net
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultMTUSizes is a ladder of packet sizes around the usual PPPoE and Ethernet MTUs
+var DefaultMTUSizes = []int{1452, 1472, 1480, 1492, 1500}
+
+const (
+	ipv4HeaderLength = 20
+	ipv6HeaderLength = 40
+	icmpHeaderLength = 8
+)
+
+// MTUStep is the outcome of probing a target with packets of a single size
+type MTUStep struct {
+	Size    int // The size of the whole IP packet
+	OK      bool
+	Rtt     time.Duration
+	SendErr error // Set if a request could not be sent, e.g. because it exceeds the local interface's MTU
+}
+
+// MTUResult is the outcome of probing a target at each size on the ladder
+type MTUResult struct {
+	Steps   []MTUStep
+	Largest int // The largest packet size that was answered, or 0 if none were
+}
+
+// ProbeMTU sends echo requests with the DF flag set at each of the given IP packet sizes, to find the largest size that
+// reaches the target without fragmentation. Small pings succeeding while large ones fail indicates an MTU black hole.
+func (pc *PingChecker) ProbeMTU(ctx context.Context, target Target, sizes []int) (MTUResult, error) {
+	var result MTUResult
+
+	for _, size := range sizes {
+		pinger, err := pc.makePinger(ctx, target)
+		if err != nil {
+			return result, err
+		}
+
+		headers := ipv4HeaderLength + icmpHeaderLength
+		if !pinger.isIPv4() {
+			headers = ipv6HeaderLength + icmpHeaderLength
+		}
+
+		// Allow for a single lost packet before treating the size as too large
+		pinger.Count = 2
+		pinger.Interval = 200 * time.Millisecond
+		pinger.Timeout = 2 * time.Second
+		pinger.Size = size - headers
+		pinger.DontFragment = true
+
+		stats, err := pinger.Run(ctx)
+		if err != nil {
+			return result, err
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		step := MTUStep{Size: size, OK: stats.Recv > 0, Rtt: stats.AvgRtt(), SendErr: stats.SendErr}
+		result.Steps = append(result.Steps, step)
+		if step.OK && size > result.Largest {
+			result.Largest = size
+		}
+	}
+
+	return result, nil
+}
+
+// BlackHole returns true if the smallest size was answered but the expected size was not. If the smallest size was not
+// answered either, the target may simply be down, so conclusive is false and the result says nothing about the MTU.
+func (r MTUResult) BlackHole(expected int) (blackHole, conclusive bool) {
+	if r.Largest >= expected {
+		return false, true
+	}
+	var smallest *MTUStep
+	for i := range r.Steps {
+		if smallest == nil || r.Steps[i].Size < smallest.Size {
+			smallest = &r.Steps[i]
+		}
+	}
+	if smallest == nil || !smallest.OK {
+		return false, false
+	}
+	return true, true
+}
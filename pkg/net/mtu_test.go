@@ -0,0 +1,53 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeMTULoopback(t *testing.T) {
+	checker := NewPingChecker(PingConfig{RawSocket: true})
+	target := Target{Host: "127.0.0.1", Weight: 1}
+
+	result, err := checker.ProbeMTU(context.Background(), target, []int{100, 1500})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skipf("raw ICMP socket not permitted: %v", err)
+	}
+	assert.NoError(t, err)
+	assert.Len(t, result.Steps, 2)
+	assert.True(t, result.Steps[0].OK)
+	assert.True(t, result.Steps[1].OK)
+	assert.Equal(t, 1500, result.Largest, "Loopback should pass every size on the ladder")
+
+	// Packets larger than the 64 KiB limit of IPv4 cannot be sent at all
+	result, err = checker.ProbeMTU(context.Background(), target, []int{100, 70000})
+	assert.NoError(t, err)
+	assert.False(t, result.Steps[1].OK)
+	assert.Error(t, result.Steps[1].SendErr)
+	assert.Equal(t, 100, result.Largest)
+}
+
+func TestMTUResultBlackHole(t *testing.T) {
+	result := MTUResult{Steps: []MTUStep{{Size: 1500, OK: true}, {Size: 1452, OK: true}}, Largest: 1500}
+	blackHole, conclusive := result.BlackHole(1492)
+	assert.False(t, blackHole)
+	assert.True(t, conclusive)
+
+	result = MTUResult{Steps: []MTUStep{{Size: 1452, OK: true}, {Size: 1500}}, Largest: 1452}
+	blackHole, conclusive = result.BlackHole(1492)
+	assert.True(t, blackHole, "Small packets passing while the expected size is dropped is a black hole")
+	assert.True(t, conclusive)
+
+	result = MTUResult{Steps: []MTUStep{{Size: 1452}, {Size: 1500}}}
+	blackHole, conclusive = result.BlackHole(1492)
+	assert.False(t, blackHole, "A target that answers nothing is not a black hole")
+	assert.False(t, conclusive)
+
+	blackHole, conclusive = MTUResult{}.BlackHole(1492)
+	assert.False(t, blackHole)
+	assert.False(t, conclusive)
+}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecoveryPolicy decides when a connection that was reset is considered restored
+type RecoveryPolicy struct {
+	Successes  int           // The number of consecutive replies required
+	PerTarget  bool          // If true, each target must reply Successes times, otherwise replies are counted across targets
+	MinTargets int           // The number of distinct targets that must be replying
+	StableFor  time.Duration // How long the requirements must be met without a lost reply
+	MaxWait    time.Duration // How long to wait for the connection before giving up
+}
+
+// DefaultRecoveryPolicy declares the connection restored after two replies from any target
+var DefaultRecoveryPolicy = RecoveryPolicy{
+	Successes:  2,
+	MinTargets: 1,
+	MaxWait:    30 * time.Second,
+}
+
+// withDefaults fills in the fields of the policy that were left unset from DefaultRecoveryPolicy
+func (rp RecoveryPolicy) withDefaults() RecoveryPolicy {
+	if rp.Successes < 1 {
+		rp.Successes = DefaultRecoveryPolicy.Successes
+	}
+	if rp.MinTargets < 1 {
+		rp.MinTargets = DefaultRecoveryPolicy.MinTargets
+	}
+	if rp.MaxWait <= 0 {
+		rp.MaxWait = DefaultRecoveryPolicy.MaxWait
+	}
+	return rp
+}
+
+// Validate returns an error if the policy can never be met, because the connection would have to be stable for longer
+// than the wait allows
+func (rp RecoveryPolicy) Validate() error {
+	rp = rp.withDefaults()
+	if rp.StableFor >= rp.MaxWait {
+		return fmt.Errorf("stable time of %s must be shorter than the maximum wait of %s", rp.StableFor, rp.MaxWait)
+	}
+	return nil
+}
+
+// recoveryTracker applies a RecoveryPolicy to the replies and losses seen while waiting
+type recoveryTracker struct {
+	policy      RecoveryPolicy
+	streaks     map[string]int // The consecutive replies from each target
+	order       []string
+	stableSince time.Time // When the requirements were last met, or zero if they are not currently met
+}
+
+func newRecoveryTracker(policy RecoveryPolicy, targets []Target) *recoveryTracker {
+	rt := &recoveryTracker{
+		policy:  policy.withDefaults(),
+		streaks: make(map[string]int, len(targets)),
+	}
+	for _, t := range targets {
+		rt.add(t)
+	}
+	return rt
+}
+
+// add starts tracking a target once it is being pinged
+func (rt *recoveryTracker) add(t Target) {
+	rt.order = append(rt.order, targetKey(t))
+}
+
+// drop stops tracking a target that can no longer be pinged, so that it is not required to reply
+func (rt *recoveryTracker) drop(t Target, now time.Time) {
+	key := targetKey(t)
+	delete(rt.streaks, key)
+	for i, k := range rt.order {
+		if k == key {
+			rt.order = append(rt.order[:i], rt.order[i+1:]...)
+			break
+		}
+	}
+	rt.update(now)
+}
+
+func (rt *recoveryTracker) reply(t Target, now time.Time) {
+	rt.streaks[targetKey(t)]++
+	rt.update(now)
+}
+
+func (rt *recoveryTracker) loss(t Target, now time.Time) {
+	rt.streaks[targetKey(t)] = 0
+	rt.update(now)
+}
+
+// met returns true if the reply requirements are currently satisfied, ignoring the stability period. More targets
+// cannot be required than are being pinged.
+func (rt *recoveryTracker) met() bool {
+	if len(rt.order) == 0 {
+		return false
+	}
+	minTargets := rt.policy.MinTargets
+	if minTargets > len(rt.order) {
+		minTargets = len(rt.order)
+	}
+
+	total, responding, qualified := 0, 0, 0
+	for _, streak := range rt.streaks {
+		total += streak
+		if streak > 0 {
+			responding++
+		}
+		if streak >= rt.policy.Successes {
+			qualified++
+		}
+	}
+
+	if rt.policy.PerTarget {
+		return qualified >= minTargets
+	}
+	return total >= rt.policy.Successes && responding >= minTargets
+}
+
+func (rt *recoveryTracker) update(now time.Time) {
+	met := rt.met()
+	if met && rt.stableSince.IsZero() {
+		rt.stableSince = now
+	} else if !met {
+		rt.stableSince = time.Time{}
+	}
+}
+
+// restored returns true once the requirements have been met for the stability period
+func (rt *recoveryTracker) restored(now time.Time) bool {
+	return !rt.stableSince.IsZero() && now.Sub(rt.stableSince) >= rt.policy.StableFor
+}
+
+func (rt *recoveryTracker) String() string {
+	parts := make([]string, len(rt.order))
+	for i, key := range rt.order {
+		parts[i] = fmt.Sprintf("%s:%d", key, rt.streaks[key])
+	}
+	return strings.Join(parts, ",")
+}
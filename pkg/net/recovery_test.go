@@ -0,0 +1,69 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryTracker(t *testing.T) {
+	a := Target{Host: "a", Weight: 1}
+	b := Target{Host: "b", Weight: 1}
+	targets := []Target{a, b}
+	now := time.Now()
+
+	// The default policy counts replies across targets
+	rt := newRecoveryTracker(RecoveryPolicy{}, targets)
+	rt.reply(a, now)
+	assert.False(t, rt.restored(now))
+	rt.reply(b, now)
+	assert.True(t, rt.restored(now))
+
+	// Replies from a single flaky target should not satisfy a per-target policy over two targets
+	rt = newRecoveryTracker(RecoveryPolicy{Successes: 2, PerTarget: true, MinTargets: 2}, targets)
+	rt.reply(a, now)
+	rt.reply(a, now)
+	rt.reply(a, now)
+	rt.reply(b, now)
+	assert.False(t, rt.restored(now))
+	rt.loss(a, now)
+	rt.reply(b, now)
+	assert.False(t, rt.restored(now), "A loss should reset the target's streak")
+	rt.reply(a, now)
+	rt.reply(a, now)
+	assert.True(t, rt.restored(now))
+	assert.Equal(t, "a:2,b:2", rt.String())
+
+	// The requirements must hold without interruption for the stability period
+	rt = newRecoveryTracker(RecoveryPolicy{Successes: 1, StableFor: 10 * time.Second}, targets)
+	rt.reply(a, now)
+	assert.False(t, rt.restored(now.Add(5*time.Second)))
+	rt.loss(a, now.Add(6*time.Second))
+	rt.reply(a, now.Add(7*time.Second))
+	assert.False(t, rt.restored(now.Add(12*time.Second)), "A loss should restart the stability period")
+	assert.True(t, rt.restored(now.Add(17*time.Second)))
+
+	// More targets cannot be required than are available
+	rt = newRecoveryTracker(RecoveryPolicy{Successes: 1, MinTargets: 3}, []Target{a})
+	rt.reply(a, now)
+	assert.True(t, rt.restored(now))
+
+	// A target that can no longer be pinged should not be required to reply
+	rt = newRecoveryTracker(RecoveryPolicy{Successes: 1, MinTargets: 2}, targets)
+	rt.reply(a, now)
+	assert.False(t, rt.restored(now))
+	rt.drop(b, now)
+	assert.True(t, rt.restored(now))
+	assert.Equal(t, "a:1", rt.String())
+
+	rt.drop(a, now)
+	assert.False(t, rt.restored(now), "Should not be restored without any targets")
+}
+
+func TestRecoveryPolicyValidate(t *testing.T) {
+	assert.NoError(t, RecoveryPolicy{}.Validate())
+	assert.NoError(t, RecoveryPolicy{StableFor: 10 * time.Second}.Validate(), "The default maximum wait should allow a short stable time")
+	assert.Error(t, RecoveryPolicy{StableFor: time.Minute}.Validate(), "A stable time longer than the default maximum wait can never be met")
+	assert.Error(t, RecoveryPolicy{StableFor: time.Minute, MaxWait: time.Minute}.Validate(), "A stable time equal to the maximum wait can never be met")
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the addresses of a hostname, as implemented by net.Resolver
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]stdnet.IPAddr, error)
+}
+
+// ResolveError is returned when a target's address cannot be resolved, and no previous address is known
+type ResolveError struct {
+	Host string
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("failed to resolve %s: %v", e.Host, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+type cachedAddr struct {
+	addr     *stdnet.IPAddr
+	resolved time.Time
+}
+
+// resolverCache remembers resolved target addresses, so that hostname targets can still be probed while DNS is down
+type resolverCache struct {
+	resolver Resolver
+	refresh  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedAddr
+}
+
+func newResolverCache(resolver Resolver, refresh time.Duration) *resolverCache {
+	if resolver == nil {
+		resolver = stdnet.DefaultResolver
+	}
+	return &resolverCache{
+		resolver: resolver,
+		refresh:  refresh,
+		entries:  make(map[string]cachedAddr),
+	}
+}
+
+// resolve returns the IPv4 or IPv6 address of host, looking it up again once the cached address is older than the
+// refresh interval. If the lookup fails, the last known address is used instead.
+func (c *resolverCache) resolve(ctx context.Context, host string, ipv6 bool) (*stdnet.IPAddr, error) {
+	// Literal addresses never need resolving
+	if ip := stdnet.ParseIP(host); ip != nil {
+		return &stdnet.IPAddr{IP: ip}, nil
+	}
+
+	key := host
+	if ipv6 {
+		key = "ipv6/" + host
+	}
+
+	c.mu.Lock()
+	entry, cached := c.entries[key]
+	c.mu.Unlock()
+
+	if cached && time.Since(entry.resolved) < c.refresh {
+		return entry.addr, nil
+	}
+
+	addr, err := c.lookup(ctx, host, ipv6)
+	if err != nil {
+		if cached {
+			return entry.addr, nil
+		}
+		return nil, &ResolveError{Host: host, Err: err}
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cachedAddr{addr: addr, resolved: time.Now()}
+	c.mu.Unlock()
+	return addr, nil
+}
+
+func (c *resolverCache) lookup(ctx context.Context, host string, ipv6 bool) (*stdnet.IPAddr, error) {
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for i := range addrs {
+		if (addrs[i].IP.To4() == nil) == ipv6 {
+			return &addrs[i], nil
+		}
+	}
+	if ipv6 {
+		return nil, errors.New("no IPv6 addresses found")
+	}
+	return nil, errors.New("no IPv4 addresses found")
+}
@@ -0,0 +1,59 @@
+package net
+
+import (
+	"context"
+	"errors"
+	stdnet "net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	addrs   []stdnet.IPAddr
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]stdnet.IPAddr, error) {
+	r.lookups++
+	return r.addrs, r.err
+}
+
+func TestResolverCache(t *testing.T) {
+	ctx := context.Background()
+	resolver := &fakeResolver{addrs: []stdnet.IPAddr{{IP: stdnet.ParseIP("2001:db8::1")}, {IP: stdnet.ParseIP("192.0.2.1")}}}
+	cache := newResolverCache(resolver, time.Hour)
+
+	addr, err := cache.resolve(ctx, "192.0.2.99", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.99", addr.String())
+	assert.Equal(t, 0, resolver.lookups, "Literal addresses should not be looked up")
+
+	addr, err = cache.resolve(ctx, "example.com", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", addr.String(), "Should pick the address of the requested IP version")
+
+	_, err = cache.resolve(ctx, "example.com", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resolver.lookups, "Addresses should be cached until the refresh interval")
+
+	// Once expired, a failed lookup should fall back to the last known address
+	cache.refresh = 0
+	resolver.err = errors.New("dns unreachable")
+	addr, err = cache.resolve(ctx, "example.com", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", addr.String())
+	assert.Equal(t, 2, resolver.lookups)
+	resolver.err = nil
+
+	addr, err = cache.resolve(ctx, "example.com", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", addr.String(), "IPv6 addresses should be cached separately")
+
+	resolver.err = errors.New("dns unreachable")
+	_, err = cache.resolve(ctx, "example.org", false)
+	var resolveErr *ResolveError
+	assert.True(t, errors.As(err, &resolveErr), "Unknown hosts should fail with a ResolveError")
+}
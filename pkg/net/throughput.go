@@ -0,0 +1,82 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// ThroughputConfig describes a bounded download used to measure throughput
+type ThroughputConfig struct {
+	URL         string
+	MaxBytes    int64         // The download stops after this many bytes
+	MaxDuration time.Duration // The download stops after this long, including the time to the first byte
+	Binding     Binding       // The local address or interface the download is made from
+}
+
+// ThroughputResult is the outcome of a throughput measurement
+type ThroughputResult struct {
+	Bytes    int64
+	TTFB     time.Duration // The time from sending the request to receiving the first byte of the response
+	Duration time.Duration // The time spent downloading after the first byte
+}
+
+// Mbps returns the measured throughput in megabits per second
+func (r ThroughputResult) Mbps() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * 8 / r.Duration.Seconds() / 1e6
+}
+
+// MeasureThroughput downloads from the configured URL until the byte or time limit is reached, or the response ends
+func MeasureThroughput(ctx context.Context, cfg ThroughputConfig) (ThroughputResult, error) {
+	var result ThroughputResult
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = cfg.Binding.Dialer().DialContext
+	// Compression would inflate the apparent throughput
+	transport.DisableCompression = true
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	dlCtx, cancel := context.WithTimeout(ctx, cfg.MaxDuration)
+	defer cancel()
+
+	var firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(dlCtx, trace), http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	result.TTFB = firstByte.Sub(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	result.Bytes, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, cfg.MaxBytes))
+	result.Duration = time.Since(firstByte)
+
+	// Reaching the time limit ends the measurement, but is only an error if the caller's context was cancelled
+	if err != nil && !(dlCtx.Err() != nil && ctx.Err() == nil) {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureThroughput(t *testing.T) {
+	chunk := []byte(strings.Repeat("x", 64*1024))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		for i := 0; i < 1024; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			if r.URL.Path == "/slow" {
+				w.(http.Flusher).Flush()
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	result, err := MeasureThroughput(ctx, ThroughputConfig{URL: server.URL + "/fast", MaxBytes: 1 << 20, MaxDuration: 10 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<20), result.Bytes, "Download should stop at the byte limit")
+	assert.True(t, result.TTFB > 0)
+	assert.True(t, result.Mbps() > 0)
+
+	start := time.Now()
+	result, err = MeasureThroughput(ctx, ThroughputConfig{URL: server.URL + "/slow", MaxBytes: 1 << 30, MaxDuration: 200 * time.Millisecond})
+	assert.NoError(t, err, "Reaching the time limit should not be an error")
+	assert.True(t, time.Since(start) < time.Second, "Download should stop at the time limit")
+	assert.True(t, result.Bytes > 0)
+	assert.True(t, result.Bytes < 1<<26)
+
+	_, err = MeasureThroughput(ctx, ThroughputConfig{URL: server.URL + "/missing", MaxBytes: 1 << 20, MaxDuration: time.Second})
+	assert.Error(t, err, "Should fail on an unsuccessful response")
+}
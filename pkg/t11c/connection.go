@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -39,11 +40,19 @@ import (
 	"golang.org/x/net/publicsuffix"
 )
 
+// Maintenance forms used to escalate beyond a PPP redial. These have not been confirmed against a captured page from
+// the device, so retraining and rebooting are experimental.
+const (
+	dslRetrainPath = "/cgi-bin/pages/maintenance/diagnostics/adslRetrain.cgi"
+	rebootPath     = "/cgi-bin/pages/maintenance/reboot/reboot.cgi"
+)
+
 type Connection struct {
 	DryRun   bool // If true, don't make any changes to the modem
 	Username string
 	Password string
 	Hostname string
+	Dialer   *net.Dialer // Used to make connections to the router if set, e.g. to bind to an interface
 	client   *http.Client
 	logger   log.Logger
 }
@@ -65,13 +74,21 @@ func (c *Connection) init() error {
 		return err
 	}
 
+	var transport http.RoundTripper
+	if c.Dialer != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = c.Dialer.DialContext
+		transport = t
+	}
+
 	c.client = &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// We don't want to follow any redirects automatically
 			return http.ErrUseLastResponse
 		},
-		Jar:     jar,
-		Timeout: 30 * time.Second,
+		Jar:       jar,
+		Timeout:   30 * time.Second,
+		Transport: transport,
 	}
 
 	return nil
@@ -114,6 +131,25 @@ func (c *Connection) postFormWithContext(ctx context.Context, u url.URL, data ur
 	return c.client.Do(req)
 }
 
+// Reachable checks that the router's web interface responds, without logging in, and returns the response time
+func (c *Connection) Reachable(ctx context.Context) (time.Duration, error) {
+	if c.client == nil {
+		if err := c.init(); err != nil {
+			return 0, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.getWithContext(ctx, c.getURL("/"))
+	if err != nil {
+		return 0, err
+	}
+	if err := c.ignoreBody(resp); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
 func (c *Connection) Login(ctx context.Context) error {
 	if c.client == nil {
 		if err := c.init(); err != nil {
@@ -165,29 +201,44 @@ func (c *Connection) TestSession(ctx context.Context) (bool, error) {
 	return resp.StatusCode == http.StatusOK, nil
 }
 
-func (c *Connection) ModemIsConnected(ctx context.Context) (bool, error) {
+func (c *Connection) WANStatus(ctx context.Context) (WANStatus, error) {
 	if c.client == nil {
 		if err := c.init(); err != nil {
-			return false, err
+			return WANStatus{}, err
 		}
 	}
 
 	u := c.getURL("/cgi-bin/pages/statusview.cgi")
 	resp, err := c.getWithContext(ctx, u)
 	if err != nil {
-		return false, err
+		return WANStatus{}, err
 	}
 	defer resp.Body.Close()
 
-	ip, err := extractWANIP(resp.Body)
+	status, err := extractWANStatus(resp.Body)
 	if errors.Is(err, errWANIPTextNotFound) {
-		return false, nil
+		// The status page omits the address entirely while disconnected
+		return status, nil
+	}
+	return status, err
+}
+
+// TrafficCounters reads the WAN traffic counters from the router's statistics page. The page and its element IDs have
+// not been confirmed against a captured page from the device, so this is experimental.
+func (c *Connection) TrafficCounters(ctx context.Context) (TrafficCounters, error) {
+	if c.client == nil {
+		if err := c.init(); err != nil {
+			return TrafficCounters{}, err
+		}
 	}
+
+	resp, err := c.getWithContext(ctx, c.getURL("/cgi-bin/pages/statistics/wanstats.cgi"))
 	if err != nil {
-		return false, err
+		return TrafficCounters{}, err
 	}
+	defer resp.Body.Close()
 
-	return ip != "0.0.0.0", nil
+	return extractTrafficCounters(resp.Body)
 }
 
 func (c *Connection) SetModemState(ctx context.Context, connect bool) error {
@@ -222,3 +273,40 @@ func (c *Connection) SetModemState(ctx context.Context, connect bool) error {
 	}
 	return c.ignoreBody(resp)
 }
+
+// RetrainDSL asks the modem to drop and retrain the DSL line, which also drops the PPP session. This is experimental,
+// see dslRetrainPath.
+func (c *Connection) RetrainDSL(ctx context.Context) error {
+	return c.submitMaintenance(ctx, dslRetrainPath, url.Values{"RetrainFlag": {"1"}})
+}
+
+// Reboot restarts the router. The web interface and the connection are unavailable until it has booted. This is
+// experimental, see rebootPath.
+func (c *Connection) Reboot(ctx context.Context) error {
+	return c.submitMaintenance(ctx, rebootPath, url.Values{"rebootflag": {"1"}})
+}
+
+func (c *Connection) submitMaintenance(ctx context.Context, path string, data url.Values) error {
+	if c.client == nil {
+		if err := c.init(); err != nil {
+			return err
+		}
+	}
+
+	if c.DryRun {
+		return nil
+	}
+
+	resp, err := c.postFormWithContext(ctx, c.getURL(path), data)
+	if err != nil {
+		return err
+	}
+	if err := c.ignoreBody(resp); err != nil {
+		return err
+	}
+	// The form redirects once submitted, but a missing page must not be mistaken for an action taken
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("router rejected %s: %s", path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package t11c
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitMaintenance(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(dslRetrainPath, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cgi-bin/main.html", http.StatusFound)
+	})
+	router := httptest.NewServer(mux)
+	defer router.Close()
+
+	routerURL, err := url.Parse(router.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConnection(log.NewNopLogger(), false, "admin", "admin", routerURL.Host)
+
+	assert.NoError(t, conn.RetrainDSL(context.Background()), "A redirect after submitting the form should succeed")
+	assert.Error(t, conn.Reboot(context.Background()), "A missing form should not be treated as a reboot")
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2020 George Field <george@cucurbit.dev>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package t11c
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/ks07/t11c-reset/pkg/dom"
+)
+
+var errDiagnosticPingNoResult = errors.New("no ping summary found in diagnostics page")
+
+// The diagnostics form, which runs ping on the router and responds with its output. These have not been confirmed
+// against a captured page from the device, so router pings are experimental.
+const (
+	diagnosticPingPath       = "/cgi-bin/pages/maintenance/diagnostics/ping.cgi"
+	diagnosticPingHostField  = "PingHost"
+	diagnosticPingCountField = "PingCount"
+)
+
+var (
+	pingSummaryRe = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingRttRe     = regexp.MustCompile(`min/avg/max = [\d.]+/([\d.]+)/[\d.]+ ms`)
+)
+
+// RouterPingResult is the outcome of a ping run by the router's diagnostics page
+type RouterPingResult struct {
+	Host        string
+	Transmitted int
+	Received    int
+	AvgRtt      time.Duration
+}
+
+// Loss returns the percentage of pings that were not answered
+func (r RouterPingResult) Loss() float64 {
+	if r.Transmitted == 0 {
+		return 100
+	}
+	return float64(r.Transmitted-r.Received) / float64(r.Transmitted) * 100
+}
+
+// Failed returns true if none of the pings were answered
+func (r RouterPingResult) Failed() bool {
+	return r.Received == 0
+}
+
+func (r RouterPingResult) String() string {
+	if r.Failed() {
+		return fmt.Sprintf("%s:%d/%d", r.Host, r.Received, r.Transmitted)
+	}
+	return fmt.Sprintf("%s:%d/%d:%s", r.Host, r.Received, r.Transmitted, r.AvgRtt.Round(time.Microsecond*100))
+}
+
+// DiagnosticPing pings host from the router itself, using its diagnostics page. This requires a logged in session.
+// This is experimental, see diagnosticPingPath.
+func (c *Connection) DiagnosticPing(ctx context.Context, host string, count int) (RouterPingResult, error) {
+	if c.client == nil {
+		if err := c.init(); err != nil {
+			return RouterPingResult{}, err
+		}
+	}
+
+	data := url.Values{}
+	data.Add(diagnosticPingHostField, host)
+	data.Add(diagnosticPingCountField, strconv.Itoa(count))
+
+	resp, err := c.postFormWithContext(ctx, c.getURL(diagnosticPingPath), data)
+	if err != nil {
+		return RouterPingResult{}, err
+	}
+	defer resp.Body.Close()
+
+	result, err := extractDiagnosticPing(resp.Body)
+	result.Host = host
+	return result, err
+}
+
+// extractDiagnosticPing parses the summary of the ping output shown on the diagnostics page
+func extractDiagnosticPing(body io.Reader) (RouterPingResult, error) {
+	var result RouterPingResult
+	root, err := html.Parse(body)
+	if err != nil {
+		return result, err
+	}
+	text := dom.Text(root)
+
+	summary := pingSummaryRe.FindStringSubmatch(text)
+	if summary == nil {
+		return result, errDiagnosticPingNoResult
+	}
+	result.Transmitted, _ = strconv.Atoi(summary[1])
+	result.Received, _ = strconv.Atoi(summary[2])
+
+	// The round trip times are only shown if a reply was received
+	if rtt := pingRttRe.FindStringSubmatch(text); rtt != nil {
+		if ms, err := strconv.ParseFloat(rtt[1], 64); err == nil {
+			result.AvgRtt = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package t11c
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractDiagnosticPing(t *testing.T) {
+	// Not captured from a device: an assumed form around busybox ping output, which the parser relies on
+	const pingBody = `
+<html><body>
+<form name="PingForm" method="post">
+<input type="text" name="PingHost" value="1.1.1.1">
+<textarea id="PingResult" rows="12" cols="60" readonly>PING 1.1.1.1 (1.1.1.1): 56 data bytes
+64 bytes from 1.1.1.1: seq=0 ttl=58 time=9.812 ms
+64 bytes from 1.1.1.1: seq=1 ttl=58 time=10.104 ms
+64 bytes from 1.1.1.1: seq=2 ttl=58 time=10.433 ms
+
+--- 1.1.1.1 ping statistics ---
+3 packets transmitted, 3 packets received, 0% packet loss
+round-trip min/avg/max = 9.812/10.116/10.433 ms
+</textarea>
+</form>
+</body></html>`
+
+	result, err := extractDiagnosticPing(strings.NewReader(pingBody))
+	assert.NoError(t, err, "Should parse the ping summary without error")
+	assert.Equal(t, 3, result.Transmitted)
+	assert.Equal(t, 3, result.Received)
+	assert.Equal(t, 10116*time.Microsecond, result.AvgRtt)
+	assert.False(t, result.Failed())
+
+	const lostBody = `
+<html><body>
+<textarea id="PingResult">PING 1.1.1.1 (1.1.1.1): 56 data bytes
+
+--- 1.1.1.1 ping statistics ---
+3 packets transmitted, 0 packets received, 100% packet loss
+</textarea>
+</body></html>`
+
+	result, err = extractDiagnosticPing(strings.NewReader(lostBody))
+	assert.NoError(t, err, "Should parse the ping summary when every ping was lost")
+	assert.True(t, result.Failed())
+	assert.Equal(t, 100.0, result.Loss())
+	assert.Zero(t, result.AvgRtt)
+
+	const emptyBody = `<html><body><textarea id="PingResult"></textarea></body></html>`
+
+	_, err = extractDiagnosticPing(strings.NewReader(emptyBody))
+	assert.Equal(t, errDiagnosticPingNoResult, err, "Should error if the page has no ping summary")
+}
@@ -25,6 +25,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -35,13 +36,73 @@ import (
 var errWANIPElementNotFound = errors.New("no WAN IP element found")
 var errWANIPTextNotFound = errors.New("no WAN IP text found")
 
-func extractWANIP(body io.Reader) (string, error) {
+// Element IDs of the values reported on the status page
+const (
+	wanIPID         = "DeviceInfo_WanIP"
+	wanGatewayID    = "DeviceInfo_gateway"
+	wanIPv6ID       = "DeviceInfo_WanIPv6"
+	wanIPv6PrefixID = "DeviceInfo_WanIPv6Prefix"
+)
+
+// Element IDs of the counters reported on the WAN statistics page, which are experimental like
+// Connection.TrafficCounters
+const (
+	wanRxBytesID = "WanStats_RxBytes"
+	wanTxBytesID = "WanStats_TxBytes"
+)
+
+var errTrafficCounterNotFound = errors.New("no WAN traffic counter found")
+
+// WANStatus holds the WAN addresses reported by the router's status page. Fields the router did not report are nil.
+type WANStatus struct {
+	IP         net.IP
+	Gateway    net.IP
+	IPv6       net.IP
+	IPv6Prefix *net.IPNet // The prefix delegated to the LAN
+
+	IPv6Enabled bool // The status page has an IPv6 address field, which is only shown when IPv6 is enabled
+}
+
+// Connected returns true if the router has an IPv4 WAN address
+func (s WANStatus) Connected() bool {
+	return s.IP != nil && !s.IP.IsUnspecified()
+}
+
+// IPv6Connected returns true if the router has a global IPv6 WAN address
+func (s WANStatus) IPv6Connected() bool {
+	return s.IPv6 != nil && !s.IPv6.IsUnspecified() && !s.IPv6.IsLinkLocalUnicast()
+}
+
+func extractWANStatus(body io.Reader) (WANStatus, error) {
+	var status WANStatus
 	root, err := html.Parse(body)
 	if err != nil {
-		return "", err
+		return status, err
 	}
 
-	n := dom.FindBodyElement("DeviceInfo_WanIP", root)
+	ip, err := findElementIP(root, wanIPID)
+	if err != nil {
+		return status, err
+	}
+	status.IP = net.ParseIP(ip)
+
+	// The remaining values are optional, e.g. IPv6 is only shown when enabled
+	if gateway, err := findElementIP(root, wanGatewayID); err == nil {
+		status.Gateway = net.ParseIP(gateway)
+	}
+	status.IPv6Enabled = dom.FindBodyElement(wanIPv6ID, root) != nil
+	if ipv6, err := findElementIP(root, wanIPv6ID); err == nil {
+		status.IPv6 = net.ParseIP(ipv6)
+	}
+	status.IPv6Prefix = findElementPrefix(root, wanIPv6PrefixID)
+
+	return status, nil
+}
+
+// findElementIP returns the first IP address in the text of the element with the given ID. IPv6 addresses may be
+// shown with their prefix length, which is discarded.
+func findElementIP(root *html.Node, id string) (string, error) {
+	n := dom.FindBodyElement(id, root)
 	if n == nil {
 		return "", errWANIPElementNotFound
 	}
@@ -49,6 +110,9 @@ func extractWANIP(body io.Reader) (string, error) {
 	for child := n.FirstChild; child != nil; child = child.NextSibling {
 		if child.Type == html.TextNode {
 			ipText := strings.TrimSpace(child.Data)
+			if ip, _, err := net.ParseCIDR(ipText); err == nil {
+				return ip.String(), nil
+			}
 			// Check that the string is a valid IP address
 			if ip := net.ParseIP(ipText); ip == nil {
 				continue
@@ -59,3 +123,52 @@ func extractWANIP(body io.Reader) (string, error) {
 
 	return "", errWANIPTextNotFound
 }
+
+func findElementPrefix(root *html.Node, id string) *net.IPNet {
+	n := dom.FindBodyElement(id, root)
+	if n == nil {
+		return nil
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			if _, prefix, err := net.ParseCIDR(strings.TrimSpace(child.Data)); err == nil {
+				return prefix
+			}
+		}
+	}
+	return nil
+}
+
+// TrafficCounters holds the total bytes transferred over the WAN interface since the router booted
+type TrafficCounters struct {
+	RxBytes uint64
+	TxBytes uint64
+}
+
+func extractTrafficCounters(body io.Reader) (TrafficCounters, error) {
+	var counters TrafficCounters
+	root, err := html.Parse(body)
+	if err != nil {
+		return counters, err
+	}
+
+	if counters.RxBytes, err = findElementCounter(root, wanRxBytesID); err != nil {
+		return counters, err
+	}
+	counters.TxBytes, err = findElementCounter(root, wanTxBytesID)
+	return counters, err
+}
+
+func findElementCounter(root *html.Node, id string) (uint64, error) {
+	n := dom.FindBodyElement(id, root)
+	if n == nil {
+		return 0, errTrafficCounterNotFound
+	}
+
+	count, err := strconv.ParseUint(strings.TrimSpace(dom.Text(n)), 10, 64)
+	if err != nil {
+		return 0, errTrafficCounterNotFound
+	}
+	return count, nil
+}
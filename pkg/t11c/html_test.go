@@ -42,9 +42,9 @@ func TestExtractWANIP(t *testing.T) {
 </tr></tbody></table>
 </body></html>`
 
-	ip, err := extractWANIP(strings.NewReader(statusViewBody))
+	status, err := extractWANStatus(strings.NewReader(statusViewBody))
 	assert.NoError(t, err, "Should retrieve the IP from the connected body without error")
-	assert.Equal(t, testCorrectIP, ip, "Should extract the correct, trimmed, IP")
+	assert.Equal(t, testCorrectIP, status.IP.String(), "Should extract the correct, trimmed, IP")
 
 	// Dummy response content similar to an invalid session
 	const otherBody = `
@@ -58,14 +58,104 @@ top.location.href = "http://192.168.1.1/cgi-bin/login.html";
 </script>
 </html>`
 
-	_, err = extractWANIP(strings.NewReader(otherBody))
+	_, err = extractWANStatus(strings.NewReader(otherBody))
 	assert.Error(t, err, "Should error if the WAN IP element does not exist")
 	assert.Equal(t, errWANIPElementNotFound, err, "Error from element not exists should match sentinel value")
 
 	// Status view content without IP text
 	missingTextBody := strings.Replace(statusViewBody, testCorrectIP, "", -1)
 
-	_, err = extractWANIP(strings.NewReader(missingTextBody))
+	_, err = extractWANStatus(strings.NewReader(missingTextBody))
 	assert.Error(t, err, "Should error if the WAN IP element does not contain an IP")
 	assert.Equal(t, errWANIPTextNotFound, err, "Error from IP not in element should match sentinel value")
 }
+
+func TestExtractWANStatus(t *testing.T) {
+	// Trimmed and anonymised copy of a dual-stack statusview.cgi response content
+	const statusViewBody = `
+<html><body>
+<table class="table_frame" width="96%" cellspacing="0" cellpadding="0" border="0" align="center">
+<tbody>
+    <tr>
+    <td class="table_font">&nbsp;&nbsp;-  <span id="MLG_IP_Address2"></span>: </td>
+    <td class="table_font w_blue" id="DeviceInfo_WanIP">
+192.0.2.138&nbsp;&nbsp;<input type="button" name="Disconnect" maxlength="32" value="Disconnect" onclick="reconnect(2)">
+</td>
+    </tr>
+    <tr>
+    <td class="table_font">&nbsp;&nbsp;- <span id="MLG_Default_Gateway"></span>:</td>
+    <td class="table_font w_blue" id="DeviceInfo_gateway">
+198.51.100.200
+</td>
+    </tr>
+    <tr>
+    <td class="table_font">&nbsp;&nbsp;- <span id="MLG_IPv6_Address"></span>:</td>
+    <td class="table_font w_blue" id="DeviceInfo_WanIPv6">
+2001:db8:0:1::2/64
+</td>
+    </tr>
+    <tr>
+    <td class="table_font">&nbsp;&nbsp;- <span id="MLG_IPv6_Prefix"></span>:</td>
+    <td class="table_font w_blue" id="DeviceInfo_WanIPv6Prefix">
+2001:db8:1200::/56
+</td>
+    </tr>
+</tbody></table>
+</body></html>`
+
+	status, err := extractWANStatus(strings.NewReader(statusViewBody))
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.138", status.IP.String())
+	assert.Equal(t, "198.51.100.200", status.Gateway.String())
+	assert.Equal(t, "2001:db8:0:1::2", status.IPv6.String(), "Should discard the prefix length of the WAN address")
+	assert.Equal(t, "2001:db8:1200::/56", status.IPv6Prefix.String())
+	assert.True(t, status.Connected())
+	assert.True(t, status.IPv6Connected())
+	assert.True(t, status.IPv6Enabled)
+
+	// IPv4 only, with IPv6 disconnected
+	ipv4Body := strings.Replace(statusViewBody, "2001:db8:0:1::2/64", "::", 1)
+	ipv4Body = strings.Replace(ipv4Body, "2001:db8:1200::/56", "", 1)
+	status, err = extractWANStatus(strings.NewReader(ipv4Body))
+	assert.NoError(t, err)
+	assert.True(t, status.Connected())
+	assert.False(t, status.IPv6Connected(), "An unspecified IPv6 address should not be connected")
+	assert.Nil(t, status.IPv6Prefix)
+	assert.True(t, status.IPv6Enabled, "IPv6 should be enabled while the field is shown")
+
+	// IPv6 disabled, so the IPv6 rows are not shown at all
+	noIPv6Body := statusViewBody[:strings.Index(statusViewBody, "    <tr>\n    <td class=\"table_font\">&nbsp;&nbsp;- <span id=\"MLG_IPv6_Address\">")] + "</tbody></table>\n</body></html>"
+	status, err = extractWANStatus(strings.NewReader(noIPv6Body))
+	assert.NoError(t, err)
+	assert.True(t, status.Connected())
+	assert.False(t, status.IPv6Enabled, "IPv6 should not be enabled without the field")
+
+	disconnectedBody := strings.Replace(ipv4Body, "192.0.2.138", "0.0.0.0", 1)
+	status, err = extractWANStatus(strings.NewReader(disconnectedBody))
+	assert.NoError(t, err)
+	assert.False(t, status.Connected())
+}
+
+func TestExtractTrafficCounters(t *testing.T) {
+	// Trimmed copy of the WAN statistics page
+	const wanStatsBody = `
+<html><body>
+<table class="table_frame">
+<tr><td class="table_font">Received bytes:</td><td class="table_font w_blue" id="WanStats_RxBytes">
+18446744073709551000
+</td></tr>
+<tr><td class="table_font">Transmitted bytes:</td><td class="table_font w_blue" id="WanStats_TxBytes">
+52143</td></tr>
+</table>
+</body></html>`
+
+	counters, err := extractTrafficCounters(strings.NewReader(wanStatsBody))
+	assert.NoError(t, err, "Should retrieve the counters without error")
+	assert.Equal(t, TrafficCounters{RxBytes: 18446744073709551000, TxBytes: 52143}, counters)
+
+	_, err = extractTrafficCounters(strings.NewReader(strings.Replace(wanStatsBody, "52143", "n/a", 1)))
+	assert.Equal(t, errTrafficCounterNotFound, err, "Should error if a counter is not a number")
+
+	_, err = extractTrafficCounters(strings.NewReader(`<html><body></body></html>`))
+	assert.Equal(t, errTrafficCounterNotFound, err, "Should error if the counters do not exist")
+}